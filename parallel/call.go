@@ -0,0 +1,51 @@
+package parallel
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// call runs the job at index i, retrying it according to the config's retry
+// policy and waiting on the config's limiter before each attempt. Every
+// attempt has its own [JobConfig.JobTimeout]. A panic is recovered and
+// returned as a [*PanicError] without being retried.
+func call[T any](ctx context.Context, cfg *JobConfig, i int, in any, fn func(context.Context) (T, error)) (_ T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack(), Index: i, Input: in}
+		}
+	}()
+	if cfg.JobTimeout > 0 {
+		fn = timed(cfg.JobTimeout, i, in, fn)
+	}
+	if cfg.Limiter != nil {
+		fn = limited(cfg.Limiter, fn)
+	}
+	p := cfg.Retry
+	if p == nil || p.MaxAttempts <= 1 {
+		return fn(ctx)
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) || ctx.Err() != nil {
+			return v, err
+		}
+		backoff := p.Backoff(attempt)
+		if p.MaxElapsed > 0 && time.Since(start)+backoff > p.MaxElapsed {
+			cfg.Logger.WarnContext(ctx, "parallel: job retry time exceeded",
+				"index", i, "attempt", attempt, "elapsed", time.Since(start), "error", err)
+			return v, err
+		}
+		cfg.Logger.WarnContext(ctx, "parallel: retrying job",
+			"index", i, "attempt", attempt, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return v, err
+		case <-timer.C:
+		}
+	}
+}
@@ -7,8 +7,42 @@ import (
 )
 
 type JobConfig struct {
+	// Timeout is the deadline for a whole call to Map, Do, FirstOf, MapSeq
+	// or [Pipeline.Run]. It applies to each job of a [Pool].
 	Timeout time.Duration
-	Logger  *slog.Logger
+	// JobTimeout is the deadline for each job. A job that runs out of time
+	// fails with a [*TimeoutError] and, unlike Timeout, does not stop the
+	// other jobs unless it is the first error of a fail-fast call. Timed out
+	// jobs are retried by the default [RetryPolicy] and each retry gets the
+	// full JobTimeout.
+	JobTimeout time.Duration
+	Logger     *slog.Logger
+	// MaxWorkers limits the number of jobs that run at the same time. Jobs are
+	// run by a fixed pool of MaxWorkers goroutines. Zero or less will run
+	// every job in its own goroutine.
+	MaxWorkers int
+	// CollectErrors will run every job to completion instead of stopping at
+	// the first error. The errors of failed jobs are returned together as
+	// [Errors].
+	CollectErrors bool
+	// Unordered lets [Ctrl.MapSeq] yield results as soon as they are done
+	// instead of in the order of its input.
+	Unordered bool
+	// Limiter is waited on before every job and every retry. See
+	// [NewRateLimiter].
+	Limiter Limiter
+	// Retry will retry failed jobs. Retries are logged with Logger.
+	Retry *RetryPolicy
+	// Panics controls whether panicking jobs are returned as errors or
+	// panic again in the caller. Panics are always recovered in the job's
+	// goroutine so they never crash the program from there.
+	Panics PanicMode
+	// QueueSize is the number of inputs a [Pool] holds while they wait for a
+	// free worker.
+	QueueSize int
+	// RejectWhenFull makes [Pool.Submit] return [ErrQueueFull] instead of
+	// blocking when the queue is full.
+	RejectWhenFull bool
 }
 
 func (jc *JobConfig) defaults() {
@@ -28,3 +62,11 @@ func (jc *JobConfig) context(ctx context.Context) (context.Context, context.Canc
 	}
 	return cctx, cancel
 }
+
+// workers returns the number of worker goroutines used to run n jobs.
+func (jc *JobConfig) workers(n int) int {
+	if jc.MaxWorkers <= 0 || jc.MaxWorkers > n {
+		return n
+	}
+	return jc.MaxWorkers
+}
@@ -0,0 +1,53 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// IndexError is the error returned by the job at Index.
+type IndexError struct {
+	Index int
+	Err   error
+}
+
+func (e *IndexError) Error() string { return fmt.Sprintf("job %d: %v", e.Index, e.Err) }
+func (e *IndexError) Unwrap() error { return e.Err }
+
+// Errors holds the error of every failed job in index order. It is returned
+// when [JobConfig.CollectErrors] is set and works with [errors.Is] and
+// [errors.As] like the result of [errors.Join].
+type Errors []*IndexError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// collected returns the errors gathered in collect mode or nil if there are
+// none. If the context ended before every job ran its error is joined with
+// the collected errors, or returned as is when there are none.
+func collected(ctx context.Context, errs Errors) error {
+	if len(errs) == 0 {
+		return ctx.Err()
+	}
+	slices.SortFunc(errs, func(a, b *IndexError) int { return a.Index - b.Index })
+	if ctx.Err() != nil {
+		return errors.Join(ctx.Err(), errs)
+	}
+	return errs
+}
@@ -2,7 +2,6 @@ package parallel
 
 import (
 	"context"
-	"sync"
 )
 
 func FirstOf[I, O any](
@@ -15,56 +14,49 @@ func FirstOf[I, O any](
 }
 
 // FirstOf takes an input and a list of jobs and returns the result of the job
-// that finishes first.
+// that finishes first. Jobs that fail are ignored unless every job fails. When
+// [JobConfig.MaxWorkers] is less than the number of jobs, jobs are started in
+// order as workers become free. The other jobs are cancelled once one
+// succeeds and FirstOf waits for them to return.
 func (c *Ctrl[In, Out]) FirstOf(
 	ctx context.Context,
 	in In,
 	jobs []Job[In, Out],
 ) (Out, error) {
-	type payload struct {
-		o   Out
-		err error
-	}
 	ctx, cancel := c.cfg.context(ctx)
-	ch := make(chan payload)
 	defer cancel()
-
-	// Wait for all jobs to finish before closing the channel
-	var wg sync.WaitGroup
-	wg.Add(len(jobs))
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	for _, job := range jobs {
-		go func(fn Job[In, Out]) {
-			defer wg.Done()
-			o, err := fn(ctx, in)
-			select {
-			case <-ctx.Done():
-			case ch <- payload{o, err}:
-			}
-		}(job)
-	}
-
-	var err error
+	input := func(int) any { return in }
+	ch := run(ctx, &c.cfg, len(jobs), input, func(ctx context.Context, i int) (Out, error) {
+		return jobs[i](ctx, in)
+	})
+	defer wait(cancel, ch)
+	var (
+		zero Out
+		err  error
+	)
 	for {
 		select {
 		case <-ctx.Done():
-			var zero Out
 			if err == nil {
 				err = ctx.Err()
 			}
 			return zero, err
-		case p := <-ch:
-			if p.err != nil {
+		case r, ok := <-ch:
+			if !ok {
+				// Every job failed.
+				if err == nil {
+					err = ctx.Err()
+				}
+				return zero, err
+			}
+			c.cfg.repanic(r.err)
+			if r.err != nil {
 				if err == nil {
-					err = p.err
+					err = r.err
 				}
 				continue
 			}
-			return p.o, nil
+			return r.v, nil
 		}
 	}
 }
@@ -2,7 +2,6 @@ package parallel
 
 import (
 	"context"
-	"sync"
 )
 
 // Map takes a list of inputs and applies a job to them all in parallel. If one
@@ -15,7 +14,13 @@ func Map[In, Out any](ctx context.Context, elements []In, job Job[In, Out]) ([]O
 
 // Map takes a list of inputs and applies a job to them all in parallel. If one
 // job fails then the rest of the unfinished or incomplete jobs will be
-// cancelled and may not finish.
+// cancelled and may not finish. Results are in the same order as the inputs
+// and at most [JobConfig.MaxWorkers] jobs are run at a time. Map waits for
+// every running job to return, so jobs should stop when their context is
+// cancelled.
+//
+// With [JobConfig.CollectErrors] every job is run and the results of the
+// successful jobs are returned along with the [Errors] of the failed ones.
 func (c *Ctrl[In, Out]) Map(
 	ctx context.Context,
 	elements []In,
@@ -24,40 +29,31 @@ func (c *Ctrl[In, Out]) Map(
 	ctx, cancel := c.cfg.context(ctx)
 	defer cancel()
 	var (
-		wg      sync.WaitGroup
-		errs    = make(chan error)
+		errs    Errors
 		results = make([]Out, len(elements))
 	)
-	wg.Add(len(elements))
-	go func() {
-		wg.Wait()
-		close(errs)
-	}()
-
-	for i := range elements {
-		go func(i int, e In) {
-			defer wg.Done()
-			select {
-			case <-ctx.Done():
-				errs <- ctx.Err()
+	input := func(i int) any { return elements[i] }
+	ch := run(ctx, &c.cfg, len(elements), input, func(ctx context.Context, i int) (Out, error) {
+		return job(ctx, elements[i])
+	})
+	defer wait(cancel, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return results, collected(ctx, errs)
+		case r, ok := <-ch:
+			if !ok {
+				return results, collected(ctx, errs)
+			}
+			c.cfg.repanic(r.err)
+			switch {
+			case r.err == nil:
+				results[r.i] = r.v
+			case c.cfg.CollectErrors:
+				errs = append(errs, &IndexError{Index: r.i, Err: r.err})
 			default:
-				v, err := job(ctx, e)
-				if err != nil {
-					select {
-					case <-ctx.Done():
-					case errs <- err:
-					}
-				} else {
-					results[i] = v
-				}
+				return results, r.err
 			}
-		}(i, elements[i])
-	}
-
-	for err := range errs {
-		if err != nil {
-			return results, err
 		}
 	}
-	return results, nil
 }
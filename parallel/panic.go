@@ -0,0 +1,55 @@
+package parallel
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PanicMode controls what happens when a job panics.
+type PanicMode uint8
+
+const (
+	// PanicReturn recovers the panic and returns it as a [*PanicError] like
+	// any other job error.
+	PanicReturn PanicMode = iota
+	// PanicRepanic recovers the panic in the job's goroutine and panics again
+	// with the [*PanicError] in the goroutine that called Map, Do, FirstOf, or
+	// is ranging over MapSeq.
+	PanicRepanic
+)
+
+// PanicError is the error created when a job panics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+	// Index is the index of the job or of its input.
+	Index int
+	// Input is the input passed to the job. It is nil for a [BasicJob].
+	Input any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("parallel: job %d panicked: %v", e.Index, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// repanic panics with err if it came from a panicking job and the config asks
+// for panics to be raised in the caller.
+func (jc *JobConfig) repanic(err error) {
+	if jc.Panics != PanicRepanic || err == nil {
+		return
+	}
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		panic(pe)
+	}
+}
@@ -2,7 +2,6 @@ package parallel
 
 import (
 	"context"
-	"sync"
 )
 
 type Job[I, O any] func(ctx context.Context, in I) (O, error)
@@ -41,39 +40,34 @@ func Do(ctx context.Context, jobs ...BasicJob) error {
 	return ctrl.Do(ctx, jobs)
 }
 
-// Do will execute a list of jobs in parallel.
+// Do will execute a list of jobs in parallel with at most
+// [JobConfig.MaxWorkers] jobs running at a time. It returns the first error
+// unless [JobConfig.CollectErrors] is set. The remaining jobs are cancelled
+// after an error and Do waits for every running job to return.
 func (c *Ctrl[In, Out]) Do(ctx context.Context, jobs []BasicJob) error {
 	ctx, cancel := c.cfg.context(ctx)
 	defer cancel()
-	var (
-		wg sync.WaitGroup
-		ch = make(chan error)
-	)
-	wg.Add(len(jobs))
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-	for _, job := range jobs {
-		go func(fn BasicJob) {
-			defer wg.Done()
-			err := fn(ctx)
-			select {
-			case <-ctx.Done():
-			case ch <- err:
-			}
-		}(job)
-	}
-
-	for e := range ch {
-		if e != nil {
-			return e
-		}
+	ch := run(ctx, &c.cfg, len(jobs), nil, func(ctx context.Context, i int) (struct{}, error) {
+		return struct{}{}, jobs[i](ctx)
+	})
+	defer wait(cancel, ch)
+	var errs Errors
+	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
+			return collected(ctx, errs)
+		case r, ok := <-ch:
+			if !ok {
+				return collected(ctx, errs)
+			}
+			c.cfg.repanic(r.err)
+			switch {
+			case r.err == nil:
+			case c.cfg.CollectErrors:
+				errs = append(errs, &IndexError{Index: r.i, Err: r.err})
+			default:
+				return r.err
+			}
 		}
 	}
-	return nil
 }
@@ -1,9 +1,16 @@
 package parallel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
+	"math"
+	"runtime"
+	"slices"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -66,7 +73,9 @@ func TestMapCancellation(t *testing.T) {
 func TestFirstOf(t *testing.T) {
 	job := func(n int, e error) Job[int, int] {
 		return func(ctx context.Context, in int) (int, error) {
-			time.Sleep(time.Millisecond * time.Duration(n))
+			if err := sleep(ctx, time.Millisecond*time.Duration(n)); err != nil {
+				return 0, err
+			}
 			return n, e
 		}
 	}
@@ -87,7 +96,8 @@ func TestFirstOf(t *testing.T) {
 		if res != 10 {
 			t.Errorf("expected 5, got %d", res)
 		}
-		checkBetween(t, time.Since(start), 9*time.Millisecond, 11*time.Millisecond)
+		// FirstOf also waits for the cancelled jobs to return.
+		checkBetween(t, time.Since(start), 9*time.Millisecond, 25*time.Millisecond)
 	})
 
 	t.Run("Timeout", func(t *testing.T) {
@@ -137,16 +147,13 @@ func TestMap_Err(t *testing.T) {
 	var ran5 atomic.Int32
 	ctx := t.Context()
 	in := []int{1, 2, 3, 4, 5}
-	res, err := NewCtrl[int, string](&JobConfig{Timeout: time.Minute}).Map(ctx, in, func(_ context.Context, v int) (string, error) {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
-		}
+	res, err := NewCtrl[int, string](&JobConfig{Timeout: time.Minute}).Map(ctx, in, func(ctx context.Context, v int) (string, error) {
 		if v == 2 {
 			return "", errTest
 		}
-		time.Sleep(time.Millisecond * 1000)
+		if err := sleep(ctx, time.Millisecond*1000); err != nil {
+			return "", err
+		}
 		if v == 5 {
 			ran5.Add(1)
 		}
@@ -207,7 +214,9 @@ func TestDo(t *testing.T) {
 		},
 		j, j, j, j, j,
 		func(ctx context.Context) error {
-			time.Sleep(time.Millisecond * 250)
+			if err := sleep(ctx, time.Millisecond*250); err != nil {
+				return err
+			}
 			n.Add(1)
 			return nil
 		},
@@ -230,6 +239,1211 @@ func TestDo_Cancel(t *testing.T) {
 	}
 }
 
+func TestMaxWorkers(t *testing.T) {
+	var running, peak atomic.Int32
+	track := func() func() {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return func() { running.Add(-1) }
+	}
+	check := func(t *testing.T, max int32) {
+		t.Helper()
+		if p := peak.Swap(0); p > max || p == 0 {
+			t.Errorf("expected at most %d jobs to run at once, got %d", max, p)
+		}
+	}
+
+	t.Run("Map", func(t *testing.T) {
+		in := make([]int, 200)
+		for i := range in {
+			in[i] = i
+		}
+		before := runtime.NumGoroutine()
+		ctrl := NewCtrl[int, int](&JobConfig{MaxWorkers: 4})
+		res, err := ctrl.Map(t.Context(), in, func(_ context.Context, v int) (int, error) {
+			defer track()()
+			if n := runtime.NumGoroutine(); n > before+4+2 {
+				t.Errorf("too many goroutines: %d", n)
+			}
+			return v * 2, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range res {
+			if v != i*2 {
+				t.Fatalf("result %d out of order: got %d", i, v)
+			}
+		}
+		check(t, 4)
+	})
+
+	t.Run("Do", func(t *testing.T) {
+		var (
+			jobs BasicJobs
+			n    atomic.Int32
+		)
+		for range 50 {
+			jobs.Add(func(context.Context) error {
+				defer track()()
+				n.Add(1)
+				return nil
+			})
+		}
+		err := NewCtrl[any, any](&JobConfig{MaxWorkers: 3}).Do(t.Context(), jobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Load() != 50 {
+			t.Errorf("expected all jobs to run, got %d", n.Load())
+		}
+		check(t, 3)
+	})
+
+	t.Run("FirstOf", func(t *testing.T) {
+		var jobs Jobs[int, int]
+		for i := range 10 {
+			jobs.Add(func(context.Context, int) (int, error) {
+				defer track()()
+				if i < 9 {
+					return 0, errors.New("fail")
+				}
+				return i, nil
+			})
+		}
+		res, err := NewCtrl[int, int](&JobConfig{MaxWorkers: 2}).FirstOf(t.Context(), 0, jobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != 9 {
+			t.Errorf("expected 9, got %d", res)
+		}
+		check(t, 2)
+
+		jobs = jobs[:9]
+		_, err = NewCtrl[int, int](&JobConfig{MaxWorkers: 2}).FirstOf(t.Context(), 0, jobs)
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected the first job error, got %v", err)
+		}
+	})
+}
+
+func TestCollectErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	cfg := JobConfig{CollectErrors: true, MaxWorkers: 3}
+
+	t.Run("Map", func(t *testing.T) {
+		in := []int{0, 1, 2, 3, 4, 5, 6}
+		res, err := NewCtrl[int, int](&cfg).Map(t.Context(), in, func(_ context.Context, v int) (int, error) {
+			if v%2 == 1 {
+				return 0, errOdd
+			}
+			return v * 10, nil
+		})
+		if !errors.Is(err, errOdd) {
+			t.Fatalf("expected %v, got %v", errOdd, err)
+		}
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Fatalf("expected Errors, got %T", err)
+		}
+		var failed []int
+		for _, e := range errs {
+			failed = append(failed, e.Index)
+		}
+		if fmt.Sprint(failed) != "[1 3 5]" {
+			t.Errorf("wrong failed indexes: %v", failed)
+		}
+		if fmt.Sprint(res) != "[0 0 20 0 40 0 60]" {
+			t.Errorf("wrong results: %v", res)
+		}
+		if errs.Error() != "job 1: odd\njob 3: odd\njob 5: odd" {
+			t.Errorf("wrong error message: %q", errs.Error())
+		}
+
+		res, err = NewCtrl[int, int](&cfg).Map(t.Context(), []int{2, 4}, func(_ context.Context, v int) (int, error) {
+			return v, nil
+		})
+		if err != nil {
+			t.Fatalf("expected a nil error, got %#v", err)
+		}
+		if fmt.Sprint(res) != "[2 4]" {
+			t.Errorf("wrong results: %v", res)
+		}
+	})
+
+	t.Run("Do", func(t *testing.T) {
+		var n atomic.Int32
+		fail := func(context.Context) error {
+			n.Add(1)
+			return errOdd
+		}
+		ok := func(context.Context) error {
+			n.Add(1)
+			return nil
+		}
+		err := NewCtrl[any, any](&cfg).Do(t.Context(), BasicJobs{ok, fail, ok, ok, fail})
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Fatalf("expected Errors, got %v", err)
+		}
+		if len(errs) != 2 || errs[0].Index != 1 || errs[1].Index != 4 {
+			t.Errorf("wrong errors: %v", errs)
+		}
+		if n.Load() != 5 {
+			t.Errorf("expected every job to run, got %d", n.Load())
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		ctrl := NewCtrl[int, int](&JobConfig{CollectErrors: true, MaxWorkers: 1})
+		_, err := ctrl.Map(ctx, []int{0, 1, 2, 3}, func(_ context.Context, v int) (int, error) {
+			if v == 1 {
+				cancel()
+			}
+			return 0, errOdd
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancellation error, got %v", err)
+		}
+	})
+
+	t.Run("CanceledWithoutErrors", func(t *testing.T) {
+		// Callers may compare the error directly when nothing else failed.
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		for _, cfg := range []JobConfig{{}, {CollectErrors: true}} {
+			_, err := NewCtrl[int, int](&cfg).Map(ctx, []int{0, 1}, func(ctx context.Context, v int) (int, error) {
+				return v, nil
+			})
+			if err != context.Canceled {
+				t.Errorf("expected context.Canceled from Map, got %#v", err)
+			}
+			err = NewCtrl[any, any](&cfg).Do(ctx, BasicJobs{func(context.Context) error { return nil }})
+			if err != context.Canceled {
+				t.Errorf("expected context.Canceled from Do, got %#v", err)
+			}
+		}
+	})
+}
+
+func TestMapSeq(t *testing.T) {
+	count := func(n int) iter.Seq[int] {
+		return func(yield func(int) bool) {
+			for i := range n {
+				if !yield(i) {
+					return
+				}
+			}
+		}
+	}
+	// Later elements finish first.
+	slowFirst := func(_ context.Context, v int) (int, error) {
+		time.Sleep(time.Duration(10-v%10) * time.Millisecond / 4)
+		return v * 2, nil
+	}
+
+	t.Run("Ordered", func(t *testing.T) {
+		var res []int
+		for v, err := range NewCtrl[int, int](&JobConfig{MaxWorkers: 4}).MapSeq(t.Context(), count(50), slowFirst) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, v)
+		}
+		if len(res) != 50 {
+			t.Fatalf("expected 50 results, got %d", len(res))
+		}
+		for i, v := range res {
+			if v != i*2 {
+				t.Fatalf("result %d out of order: got %d", i, v)
+			}
+		}
+	})
+
+	t.Run("Unordered", func(t *testing.T) {
+		var res []int
+		// The first job only finishes after another result has been yielded
+		// which can only happen if results are not kept in order.
+		yielded := make(chan struct{})
+		job := func(ctx context.Context, v int) (int, error) {
+			if v == 0 {
+				select {
+				case <-yielded:
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				}
+			}
+			return v * 2, nil
+		}
+		ctrl := NewCtrl[int, int](&JobConfig{MaxWorkers: 10, Unordered: true, Timeout: 5 * time.Second})
+		for v, err := range ctrl.MapSeq(t.Context(), count(10), job) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) == 0 {
+				close(yielded)
+			}
+			res = append(res, v)
+		}
+		if len(res) != 10 {
+			t.Fatalf("expected 10 results, got %d", len(res))
+		}
+		if res[0] == 0 {
+			t.Errorf("expected results in completion order, got %v", res)
+		}
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		var pulled, done atomic.Int32
+		seq := func(yield func(int) bool) {
+			for i := 0; ; i++ {
+				pulled.Add(1)
+				if !yield(i) {
+					return
+				}
+			}
+		}
+		ctrl := NewCtrl[int, int](&JobConfig{MaxWorkers: 3})
+		for v, err := range ctrl.MapSeq(t.Context(), seq, func(_ context.Context, v int) (int, error) {
+			done.Add(1)
+			return v, nil
+		}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ahead := pulled.Load() - int32(v); ahead > 2*3+2 {
+				t.Fatalf("pulled %d elements ahead of the consumer", ahead)
+			}
+			if v == 100 {
+				break
+			}
+		}
+		n := pulled.Load()
+		time.Sleep(5 * time.Millisecond)
+		if pulled.Load() != n {
+			t.Error("sequence was still being consumed after break")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		errTest := errors.New("test error")
+		job := func(_ context.Context, v int) (int, error) {
+			if v%3 == 2 {
+				return 0, errTest
+			}
+			return v, nil
+		}
+		var (
+			res []int
+			err error
+		)
+		for v, e := range NewCtrl[int, int](&JobConfig{MaxWorkers: 2}).MapSeq(t.Context(), count(10), job) {
+			if e != nil {
+				err = e
+				continue
+			}
+			res = append(res, v)
+		}
+		var ie *IndexError
+		if !errors.As(err, &ie) || ie.Index != 2 || !errors.Is(err, errTest) {
+			t.Errorf("expected an error for index 2, got %v", err)
+		}
+		if fmt.Sprint(res) != "[0 1]" {
+			t.Errorf("expected iteration to stop at the error, got %v", res)
+		}
+
+		var failed []int
+		res = res[:0]
+		ctrl := NewCtrl[int, int](&JobConfig{MaxWorkers: 2, CollectErrors: true})
+		for v, e := range ctrl.MapSeq(t.Context(), count(10), job) {
+			if errors.As(e, &ie) {
+				failed = append(failed, ie.Index)
+				continue
+			}
+			res = append(res, v)
+		}
+		if fmt.Sprint(failed) != "[2 5 8]" || fmt.Sprint(res) != "[0 1 3 4 6 7 9]" {
+			t.Errorf("wrong results %v and errors %v", res, failed)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		var err error
+		for v, e := range MapSeq(ctx, count(1000), func(_ context.Context, v int) (int, error) {
+			return v, nil
+		}) {
+			if v == 10 {
+				cancel()
+			}
+			err = e
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancellation error, got %v", err)
+		}
+	})
+}
+
+func TestRetry(t *testing.T) {
+	errTemp := errors.New("temporary")
+	errFatal := errors.New("fatal")
+
+	t.Run("Backoff", func(t *testing.T) {
+		p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+		for i, want := range []time.Duration{10, 20, 40, 50, 50} {
+			if got := p.Backoff(i + 1); got != want*time.Millisecond {
+				t.Errorf("attempt %d: expected %v, got %v", i+1, want*time.Millisecond, got)
+			}
+		}
+		p.Jitter = 0.5
+		for range 100 {
+			if got := p.Backoff(2); got < 10*time.Millisecond || got > 20*time.Millisecond {
+				t.Fatalf("jittered backoff %v out of range", got)
+			}
+		}
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		var (
+			logs     bytes.Buffer
+			attempts [5]atomic.Int32
+		)
+		ctrl := NewCtrl[int, int](&JobConfig{
+			Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+			Retry: &RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				Jitter:         0.2,
+				Retryable:      func(err error) bool { return errors.Is(err, errTemp) },
+			},
+		})
+		res, err := ctrl.Map(t.Context(), []int{0, 1, 2, 3, 4}, func(_ context.Context, v int) (int, error) {
+			if attempts[v].Add(1) < 3 {
+				return 0, errTemp
+			}
+			return v, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(res) != "[0 1 2 3 4]" {
+			t.Errorf("wrong results: %v", res)
+		}
+		for i := range attempts {
+			if n := attempts[i].Load(); n != 3 {
+				t.Errorf("job %d: expected 3 attempts, got %d", i, n)
+			}
+		}
+		if n := strings.Count(logs.String(), "parallel: retrying job"); n != 10 {
+			t.Errorf("expected 10 retries to be logged, got %d:\n%s", n, logs.String())
+		}
+
+		// Errors that are not retryable fail right away.
+		var n atomic.Int32
+		_, err = ctrl.Map(t.Context(), []int{0}, func(context.Context, int) (int, error) {
+			n.Add(1)
+			return 0, errFatal
+		})
+		if !errors.Is(err, errFatal) || n.Load() != 1 {
+			t.Errorf("expected one attempt and a fatal error, got %d and %v", n.Load(), err)
+		}
+	})
+
+	t.Run("MaxElapsed", func(t *testing.T) {
+		var n atomic.Int32
+		ctrl := NewCtrl[any, any](&JobConfig{
+			Logger: slog.New(slog.DiscardHandler),
+			Retry: &RetryPolicy{
+				MaxAttempts:    100,
+				InitialBackoff: 10 * time.Millisecond,
+				Multiplier:     1,
+				MaxElapsed:     35 * time.Millisecond,
+			},
+		})
+		err := ctrl.Do(t.Context(), BasicJobs{func(context.Context) error {
+			n.Add(1)
+			return errTemp
+		}})
+		if !errors.Is(err, errTemp) {
+			t.Errorf("expected %v, got %v", errTemp, err)
+		}
+		// Attempts start at 0, 10, 20, and 30ms. The next would end after the cap.
+		if n.Load() < 2 || n.Load() > 4 {
+			t.Errorf("expected at most 4 attempts within the time cap, got %d", n.Load())
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		defer cancel()
+		ctrl := NewCtrl[any, any](&JobConfig{
+			Logger: slog.New(slog.DiscardHandler),
+			Retry:  &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour},
+		})
+		start := time.Now()
+		err := ctrl.Do(ctx, BasicJobs{func(context.Context) error { return errTemp }})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline error, got %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Error("retry backoff did not stop when the context was done")
+		}
+	})
+}
+
+func TestPanics(t *testing.T) {
+	boom := func(_ context.Context, v string) (string, error) {
+		if v == "bad" {
+			panic("boom")
+		}
+		return v, nil
+	}
+
+	t.Run("Return", func(t *testing.T) {
+		_, err := Map(t.Context(), []string{"a", "bad", "c"}, boom)
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expected a *PanicError, got %v", err)
+		}
+		if pe.Value != "boom" || pe.Index != 1 || pe.Input != "bad" {
+			t.Errorf("wrong panic error: %+v", pe)
+		}
+		if !strings.Contains(string(pe.Stack), "TestPanics") {
+			t.Errorf("stack does not include the panicking function:\n%s", pe.Stack)
+		}
+
+		errTest := errors.New("test error")
+		err = Do(t.Context(), func(context.Context) error { return nil }, func(context.Context) error { panic(errTest) })
+		if !errors.As(err, &pe) || pe.Index != 1 || pe.Input != nil {
+			t.Errorf("expected a *PanicError from job 1, got %v", err)
+		}
+		if !errors.Is(err, errTest) {
+			t.Error("PanicError should unwrap to a panicked error")
+		}
+
+		// A panic is a failure so FirstOf uses another job.
+		res, err := FirstOf(t.Context(), "bad",
+			func(ctx context.Context, in string) (string, error) { return boom(ctx, in) },
+			func(context.Context, string) (string, error) {
+				time.Sleep(time.Millisecond)
+				return "ok", nil
+			},
+		)
+		if err != nil || res != "ok" {
+			t.Errorf("expected \"ok\", got %q and %v", res, err)
+		}
+	})
+
+	t.Run("NotRetried", func(t *testing.T) {
+		var n atomic.Int32
+		ctrl := NewCtrl[any, any](&JobConfig{Retry: &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}})
+		err := ctrl.Do(t.Context(), BasicJobs{func(context.Context) error {
+			n.Add(1)
+			panic("boom")
+		}})
+		var pe *PanicError
+		if !errors.As(err, &pe) || n.Load() != 1 {
+			t.Errorf("expected one attempt and a *PanicError, got %d and %v", n.Load(), err)
+		}
+	})
+
+	t.Run("Repanic", func(t *testing.T) {
+		cfg := JobConfig{Panics: PanicRepanic}
+		expectPanic := func(t *testing.T, fn func()) {
+			t.Helper()
+			defer func() {
+				t.Helper()
+				pe, ok := recover().(*PanicError)
+				if !ok || pe.Value != "boom" {
+					t.Errorf("expected to panic with a *PanicError, got %v", pe)
+				}
+			}()
+			fn()
+		}
+		expectPanic(t, func() {
+			NewCtrl[string, string](&cfg).Map(t.Context(), []string{"a", "bad"}, boom)
+		})
+		expectPanic(t, func() {
+			NewCtrl[string, string](&cfg).FirstOf(t.Context(), "bad", Jobs[string, string]{boom})
+		})
+		expectPanic(t, func() {
+			NewCtrl[any, any](&cfg).Do(t.Context(), BasicJobs{func(context.Context) error { panic("boom") }})
+		})
+		expectPanic(t, func() {
+			seq := slices.Values([]string{"a", "bad", "c"})
+			for range NewCtrl[string, string](&cfg).MapSeq(t.Context(), seq, boom) {
+			}
+		})
+	})
+}
+
+func TestNoLeaks(t *testing.T) {
+	errTest := errors.New("test error")
+	var running atomic.Int32
+	// job fails for the input 0 and waits for cancellation otherwise.
+	job := func(ctx context.Context, v int) (int, error) {
+		running.Add(1)
+		defer running.Add(-1)
+		if v == 0 {
+			time.Sleep(time.Millisecond)
+			return 0, errTest
+		}
+		<-ctx.Done()
+		time.Sleep(time.Millisecond) // keep running after cancellation
+		return 0, ctx.Err()
+	}
+	// The failing input is first so it runs when workers are limited.
+	in := []int{0, 1, 2, 3, 4, 5}
+	jobs := make([]Job[int, int], len(in))
+	basic := make(BasicJobs, len(in))
+	for i, v := range in {
+		jobs[i] = func(ctx context.Context, _ int) (int, error) { return job(ctx, v) }
+		basic[i] = func(ctx context.Context) error { _, err := job(ctx, v); return err }
+	}
+	check := func(t *testing.T) {
+		t.Helper()
+		if n := running.Load(); n != 0 {
+			t.Errorf("returned with %d jobs still running", n)
+		}
+		checkNoGoroutines(t)
+	}
+
+	for name, cfg := range map[string]*JobConfig{
+		"Default":    {},
+		"MaxWorkers": {MaxWorkers: 2},
+		"Timeout":    {Timeout: 5 * time.Millisecond},
+		"Repanic":    {Panics: PanicRepanic},
+	} {
+		t.Run("Map/"+name, func(t *testing.T) {
+			_, err := NewCtrl[int, int](cfg).Map(t.Context(), in, job)
+			if err == nil {
+				t.Error("expected an error")
+			}
+			check(t)
+		})
+		t.Run("Do/"+name, func(t *testing.T) {
+			if err := NewCtrl[any, any](cfg).Do(t.Context(), basic); err == nil {
+				t.Error("expected an error")
+			}
+			check(t)
+		})
+		t.Run("FirstOf/"+name, func(t *testing.T) {
+			first := append(Jobs[int, int]{func(context.Context, int) (int, error) { return 7, nil }}, jobs...)
+			res, err := NewCtrl[int, int](cfg).FirstOf(t.Context(), 0, first)
+			if err != nil || res != 7 {
+				t.Errorf("expected 7, got %d and %v", res, err)
+			}
+			check(t)
+		})
+		t.Run("MapSeq/"+name, func(t *testing.T) {
+			for _, err := range NewCtrl[int, int](cfg).MapSeq(t.Context(), slices.Values(in), job) {
+				if err != nil {
+					break
+				}
+			}
+			check(t)
+		})
+	}
+
+	t.Run("Map/Panic", func(t *testing.T) {
+		func() {
+			defer func() { recover() }()
+			NewCtrl[int, int](&JobConfig{Panics: PanicRepanic}).Map(t.Context(), in,
+				func(ctx context.Context, v int) (int, error) {
+					if v == 0 {
+						panic("boom")
+					}
+					return job(ctx, v)
+				})
+		}()
+		check(t)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		time.AfterFunc(time.Millisecond, cancel)
+		if err := Do(ctx, basic[1:3]...); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled error, got %v", err)
+		}
+		check(t)
+	})
+}
+
+func TestPool(t *testing.T) {
+	double := func(_ context.Context, v int) (int, error) { return v * 2, nil }
+
+	t.Run("Submit", func(t *testing.T) {
+		ctx := t.Context()
+		pool := NewPool(double, &JobConfig{MaxWorkers: 3})
+		futures := make([]*Future[int], 20)
+		for i := range futures {
+			f, err := pool.Submit(ctx, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			futures[i] = f
+		}
+		for i, f := range futures {
+			v, err := f.Wait(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != i*2 {
+				t.Errorf("expected %d, got %d", i*2, v)
+			}
+		}
+		if err := pool.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Submit(ctx, 1); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("expected ErrPoolClosed after shutdown, got %v", err)
+		}
+		checkNoGoroutines(t)
+	})
+
+	// blocked returns a job that waits for release or cancellation.
+	blocked := func() (Job[int, int], chan struct{}) {
+		release := make(chan struct{})
+		return func(ctx context.Context, v int) (int, error) {
+			select {
+			case <-release:
+				return v, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}, release
+	}
+
+	t.Run("Backpressure", func(t *testing.T) {
+		job, release := blocked()
+		pool := NewPool(job, &JobConfig{MaxWorkers: 1, QueueSize: 1})
+		defer pool.Stop()
+		if _, err := pool.Submit(t.Context(), 1); err != nil { // running
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		if _, err := pool.Submit(t.Context(), 2); err != nil { // queued
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Millisecond)
+		defer cancel()
+		if _, err := pool.Submit(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Submit to block until the deadline, got %v", err)
+		}
+		close(release)
+		f, err := pool.Submit(t.Context(), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := f.Wait(t.Context()); err != nil || v != 3 {
+			t.Errorf("expected 3, got %d and %v", v, err)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		job, release := blocked()
+		defer close(release)
+		pool := NewPool(job, &JobConfig{MaxWorkers: 1, QueueSize: 1, RejectWhenFull: true})
+		defer pool.Stop()
+		var rejected int
+		for i := range 5 {
+			if _, err := pool.Submit(t.Context(), i); errors.Is(err, ErrQueueFull) {
+				rejected++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if rejected != 3 {
+			t.Errorf("expected 3 rejected inputs, got %d", rejected)
+		}
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		var n atomic.Int32
+		pool := NewPool(func(ctx context.Context, v int) (int, error) {
+			time.Sleep(time.Millisecond)
+			n.Add(1)
+			return v, nil
+		}, &JobConfig{MaxWorkers: 2, QueueSize: 10})
+		for i := range 10 {
+			if _, err := pool.Submit(t.Context(), i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pool.Shutdown(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if n.Load() != 10 {
+			t.Errorf("expected shutdown to drain all 10 jobs, got %d", n.Load())
+		}
+		checkNoGoroutines(t)
+
+		job, _ := blocked()
+		pool = NewPool(job, &JobConfig{MaxWorkers: 1, QueueSize: 1})
+		running, _ := pool.Submit(t.Context(), 1)
+		queued, _ := pool.Submit(t.Context(), 2)
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Millisecond)
+		defer cancel()
+		if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected shutdown to time out, got %v", err)
+		}
+		if _, err := running.Wait(t.Context()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the running job to be cancelled, got %v", err)
+		}
+		if _, err := queued.Wait(t.Context()); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("expected the queued job to be dropped, got %v", err)
+		}
+		checkNoGoroutines(t)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		job, _ := blocked()
+		pool := NewPool(job, &JobConfig{MaxWorkers: 1, QueueSize: 1})
+		running, _ := pool.Submit(t.Context(), 1)
+		time.Sleep(time.Millisecond)
+		queued, _ := pool.Submit(t.Context(), 2)
+		done := make(chan error)
+		go func() {
+			_, err := pool.Submit(t.Context(), 3) // blocked on the full queue
+			done <- err
+		}()
+		time.Sleep(time.Millisecond)
+		pool.Stop()
+		if err := <-done; !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("expected blocked submit to fail with ErrPoolClosed, got %v", err)
+		}
+		if _, err := running.Wait(t.Context()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the running job to be cancelled, got %v", err)
+		}
+		if _, err := queued.Wait(t.Context()); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("expected the queued job to be dropped, got %v", err)
+		}
+		checkNoGoroutines(t)
+	})
+
+	t.Run("Panics", func(t *testing.T) {
+		pool := NewPool(func(context.Context, int) (int, error) { panic("boom") }, nil)
+		defer pool.Stop()
+		f, err := pool.Submit(t.Context(), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Wait(t.Context())
+		var pe *PanicError
+		if !errors.As(err, &pe) || pe.Input != 7 {
+			t.Errorf("expected a *PanicError for input 7, got %v", err)
+		}
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	errTest := errors.New("test error")
+	parse := NewPipeline(nil, Stage[string, int]{
+		Name: "parse",
+		Job: func(_ context.Context, s string) (int, error) {
+			if s == "bad" {
+				return 0, errTest
+			}
+			return len(s), nil
+		},
+		Workers: 2,
+		Buffer:  1,
+	})
+	square := Then(parse, Stage[int, int]{
+		Job:     func(_ context.Context, v int) (int, error) { return v * v, nil },
+		Workers: 3,
+	})
+	format := Then(square, Stage[int, string]{
+		Name: "format",
+		Job: func(ctx context.Context, v int) (string, error) {
+			return fmt.Sprint(v), sleep(ctx, time.Millisecond)
+		},
+		Workers: 4,
+		Buffer:  4,
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		in := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+		var res []string
+		for v, err := range format.Run(t.Context(), slices.Values(in)) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, v)
+		}
+		slices.Sort(res)
+		if !slices.Equal(res, []string{"1", "16", "25", "4", "9"}) {
+			t.Errorf("wrong results: %v", res)
+		}
+		m := format.Metrics()
+		if len(m) != 3 {
+			t.Fatalf("expected 3 stages of metrics, got %d", len(m))
+		}
+		for i, name := range []string{"parse", "stage 1", "format"} {
+			if m[i].Name != name || m[i].In != 5 || m[i].Out != 5 || m[i].Errors != 0 {
+				t.Errorf("wrong metrics for stage %d: %+v", i, m[i])
+			}
+		}
+		if m[2].Workers != 4 || m[2].Busy < 5*time.Millisecond {
+			t.Errorf("wrong metrics for the last stage: %+v", m[2])
+		}
+		if m := parse.Metrics(); m[0].In != 0 {
+			t.Errorf("metrics should not be shared between pipelines: %+v", m[0])
+		}
+		checkNoGoroutines(t)
+	})
+
+	t.Run("Ordered", func(t *testing.T) {
+		p := Then(NewPipeline(nil, Stage[int, int]{Job: func(_ context.Context, v int) (int, error) {
+			return v + 1, nil
+		}}), Stage[int, int]{Job: func(_ context.Context, v int) (int, error) {
+			return v * 2, nil
+		}})
+		var res []int
+		for v, err := range p.Run(t.Context(), slices.Values([]int{0, 1, 2, 3})) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, v)
+		}
+		if !slices.Equal(res, []int{2, 4, 6, 8}) {
+			t.Errorf("expected results in order, got %v", res)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		in := []string{"a", "bb", "bad", "ccc"}
+		var errs []error
+		for _, err := range format.Run(t.Context(), slices.Values(in)) {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) != 1 {
+			t.Fatalf("expected to stop at the first error, got %v", errs)
+		}
+		var (
+			ie *IndexError
+			se *StageError
+		)
+		if !errors.As(errs[0], &ie) || ie.Index != 2 || !errors.As(errs[0], &se) || se.Stage != "parse" {
+			t.Errorf("expected a stage error for input 2, got %v", errs[0])
+		}
+		if !errors.Is(errs[0], errTest) {
+			t.Errorf("expected %v, got %v", errTest, errs[0])
+		}
+		checkNoGoroutines(t)
+	})
+
+	t.Run("CollectErrors", func(t *testing.T) {
+		p := NewPipeline(&JobConfig{CollectErrors: true}, Stage[int, int]{
+			Job: func(_ context.Context, v int) (int, error) {
+				if v%3 == 0 {
+					return 0, errTest
+				}
+				return v, nil
+			},
+			Workers: 4,
+		})
+		var res, failed []int
+		for v, err := range p.Run(t.Context(), slices.Values([]int{0, 1, 2, 3, 4, 5, 6})) {
+			var ie *IndexError
+			if errors.As(err, &ie) {
+				failed = append(failed, ie.Index)
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				res = append(res, v)
+			}
+		}
+		slices.Sort(res)
+		slices.Sort(failed)
+		if !slices.Equal(res, []int{1, 2, 4, 5}) || !slices.Equal(failed, []int{0, 3, 6}) {
+			t.Errorf("wrong results %v and errors %v", res, failed)
+		}
+		if m := p.Metrics(); m[0].Errors != 3 || m[0].Out != 4 {
+			t.Errorf("wrong metrics: %+v", m[0])
+		}
+	})
+
+	t.Run("Break", func(t *testing.T) {
+		var n int
+		infinite := func(yield func(string) bool) {
+			for yield("abc") {
+			}
+		}
+		for v, err := range format.Run(t.Context(), infinite) {
+			if err != nil || v != "9" {
+				t.Fatalf("expected \"9\", got %q and %v", v, err)
+			}
+			if n++; n == 10 {
+				break
+			}
+		}
+		checkNoGoroutines(t)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		p := NewPipeline(&JobConfig{Timeout: 5 * time.Millisecond}, Stage[int, int]{
+			Job: func(ctx context.Context, v int) (int, error) {
+				return v, sleep(ctx, time.Duration(v)*time.Millisecond)
+			},
+		})
+		var err error
+		for _, err = range p.Run(t.Context(), slices.Values([]int{1, 1, 100, 1})) {
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context deadline exceeded error, got %v", err)
+		}
+		checkNoGoroutines(t)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	in := make([]int, 15)
+	job := func(_ context.Context, v int) (int, error) { return v, nil }
+
+	t.Run("Map", func(t *testing.T) {
+		limiter := NewRateLimiter(200, 5)
+		start := time.Now()
+		_, err := NewCtrl[int, int](&JobConfig{Limiter: limiter}).Map(t.Context(), in, job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The first 5 run right away then one every 5ms. Only the lower
+		// bound is guaranteed.
+		checkBetween(t, time.Since(start), 50*time.Millisecond, time.Second)
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		limiter := &countingLimiter{Limiter: NewRateLimiter(200, 1)}
+		a := NewCtrl[int, int](&JobConfig{Limiter: limiter})
+		b := NewCtrl[int, int](&JobConfig{Limiter: limiter, MaxWorkers: 2})
+		start := time.Now()
+		err := Do(t.Context(),
+			func(ctx context.Context) error { _, err := a.Map(ctx, in[:10], job); return err },
+			func(ctx context.Context) error { _, err := b.Map(ctx, in[:10], job); return err },
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := limiter.n.Load(); n != 20 {
+			t.Errorf("expected 20 jobs to take a token, got %d", n)
+		}
+		// One token at a time for 20 jobs. Separate limiters would take
+		// half as long.
+		checkBetween(t, time.Since(start), 95*time.Millisecond, time.Second)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		var n atomic.Int32
+		ctrl := NewCtrl[any, any](&JobConfig{
+			Limiter: NewRateLimiter(200, 1),
+			Retry:   &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Nanosecond},
+			Logger:  slog.New(slog.DiscardHandler),
+		})
+		start := time.Now()
+		ctrl.Do(t.Context(), BasicJobs{func(context.Context) error {
+			n.Add(1)
+			return errors.New("test error")
+		}})
+		if n.Load() != 3 {
+			t.Errorf("expected 3 attempts, got %d", n.Load())
+		}
+		checkBetween(t, time.Since(start), 10*time.Millisecond, time.Second)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 1)
+		if err := limiter.Wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Millisecond)
+		defer cancel()
+		_, err := NewCtrl[int, int](&JobConfig{Limiter: limiter}).Map(ctx, in, job)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context deadline exceeded error, got %v", err)
+		}
+		// Cancelled waits give their tokens back.
+		limiter.mu.Lock()
+		tokens := limiter.tokens
+		limiter.mu.Unlock()
+		if tokens < -0.5 {
+			t.Errorf("expected the reserved tokens to be returned, have %f", tokens)
+		}
+	})
+
+	t.Run("InvalidRate", func(t *testing.T) {
+		for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("expected NewRateLimiter(%v, 1) to panic", rate)
+					}
+				}()
+				NewRateLimiter(rate, 1)
+			}()
+		}
+	})
+}
+
+func TestJobTimeout(t *testing.T) {
+	job := func(ctx context.Context, ms int) (int, error) {
+		return ms, sleep(ctx, time.Duration(ms)*time.Millisecond)
+	}
+
+	t.Run("FailFast", func(t *testing.T) {
+		start := time.Now()
+		ctrl := NewCtrl[int, int](&JobConfig{JobTimeout: 10 * time.Millisecond})
+		_, err := ctrl.Map(t.Context(), []int{1, 100, 2}, job)
+		var te *TimeoutError
+		if !errors.As(err, &te) || te.Index != 1 || te.Input != 100 {
+			t.Fatalf("expected a timeout for input 1, got %v", err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("timeout error should be a context deadline exceeded error")
+		}
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Errorf("expected the job to time out early, took %v", d)
+		}
+	})
+
+	t.Run("CollectErrors", func(t *testing.T) {
+		ctrl := NewCtrl[int, int](&JobConfig{JobTimeout: 10 * time.Millisecond, CollectErrors: true})
+		res, err := ctrl.Map(t.Context(), []int{1, 100, 2, 200}, job)
+		if res[0] != 1 || res[2] != 2 {
+			t.Errorf("expected the fast jobs to finish, got %v", res)
+		}
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 2 {
+			t.Fatalf("expected 2 errors, got %v", err)
+		}
+		for i, e := range errs {
+			var te *TimeoutError
+			if !errors.As(e, &te) || te.Index != 1+2*i || te.Index != e.Index {
+				t.Errorf("expected a timeout for input %d, got %v", 1+2*i, e)
+			}
+		}
+
+		err = NewCtrl[any, any](&JobConfig{JobTimeout: 5 * time.Millisecond, CollectErrors: true}).Do(t.Context(), BasicJobs{
+			func(ctx context.Context) error { return nil },
+			func(ctx context.Context) error { return sleep(ctx, time.Second) },
+		})
+		var te *TimeoutError
+		if !errors.As(err, &te) || te.Index != 1 || te.Input != nil {
+			t.Errorf("expected a timeout for job 1, got %v", err)
+		}
+	})
+
+	t.Run("BatchTimeout", func(t *testing.T) {
+		ctrl := NewCtrl[int, int](&JobConfig{Timeout: 5 * time.Millisecond, JobTimeout: time.Second})
+		_, err := ctrl.Map(t.Context(), []int{100, 100}, job)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context deadline exceeded error, got %v", err)
+		}
+		var te *TimeoutError
+		if errors.As(err, &te) {
+			t.Errorf("the batch timeout should not be a job timeout: %v", err)
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		var n atomic.Int32
+		ctrl := NewCtrl[int, int](&JobConfig{
+			JobTimeout: 5 * time.Millisecond,
+			Logger:     slog.New(slog.DiscardHandler),
+			Retry: &RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+			},
+		})
+		res, err := ctrl.Map(t.Context(), []int{20}, func(ctx context.Context, ms int) (int, error) {
+			if n.Add(1) == 3 {
+				ms = 1
+			}
+			return job(ctx, ms)
+		})
+		if err != nil || res[0] != 1 {
+			t.Errorf("expected the third attempt to succeed, got %v and %v", res, err)
+		}
+	})
+
+	t.Run("RetryDeadline", func(t *testing.T) {
+		// Deadlines other than JobTimeout are not retried.
+		var n atomic.Int32
+		ctrl := NewCtrl[int, int](&JobConfig{
+			Logger: slog.New(slog.DiscardHandler),
+			Retry:  &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		})
+		_, err := ctrl.Map(t.Context(), []int{1}, func(ctx context.Context, ms int) (int, error) {
+			n.Add(1)
+			return 0, context.DeadlineExceeded
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context deadline exceeded error, got %v", err)
+		}
+		if n.Load() != 1 {
+			t.Errorf("expected one attempt, got %d", n.Load())
+		}
+	})
+}
+
+// countingLimiter counts the calls to Wait.
+type countingLimiter struct {
+	Limiter
+	n atomic.Int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.n.Add(1)
+	return l.Limiter.Wait(ctx)
+}
+
+// checkNoGoroutines fails the test if goroutines started by this package are
+// still running. Goroutines that are about to exit are given a moment to do
+// so.
+func checkNoGoroutines(t *testing.T) {
+	t.Helper()
+	var leaked []string
+	for range 50 {
+		leaked = leaked[:0]
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		for g := range strings.SplitSeq(string(buf), "\n\n") {
+			if strings.Contains(g, "harrybrwn/x/parallel.") && !strings.Contains(g, "testing.tRunner") {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("%d goroutines outlived the call:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func checkBetween(t *testing.T, took, start, end time.Duration) {
 	t.Helper()
 	if end-start < 10*time.Millisecond {
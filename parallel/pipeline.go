@@ -0,0 +1,246 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stage is one step of a [Pipeline].
+type Stage[In, Out any] struct {
+	// Name is used in errors and metrics. Defaults to "stage <n>" counting
+	// from zero.
+	Name string
+	Job  Job[In, Out]
+	// Workers is the number of goroutines running the job. Defaults to one.
+	Workers int
+	// Buffer is the number of results held for the next stage before the
+	// workers block.
+	Buffer int
+}
+
+// StageError is the error of a job in a [Pipeline] stage.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return fmt.Sprintf("stage %q: %v", e.Stage, e.Err) }
+func (e *StageError) Unwrap() error { return e.Err }
+
+// StageMetrics are the counters of a [Pipeline] stage added up over every run.
+type StageMetrics struct {
+	Name    string
+	Workers int
+	// In is the number of inputs the stage has received.
+	In int64
+	// Out is the number of results passed on to the next stage.
+	Out int64
+	// Errors is the number of failed jobs.
+	Errors int64
+	// Busy is the total time spent running jobs across all workers.
+	Busy time.Duration
+}
+
+type stageStats struct {
+	name            string
+	workers         int
+	in, out, errors atomic.Int64
+	busy            atomic.Int64
+}
+
+type pipeItem[T any] struct {
+	i int
+	v T
+}
+
+// pipeRun holds the state shared by the stages of one run.
+type pipeRun struct {
+	cfg   *JobConfig
+	stats []*stageStats
+	errs  chan error
+}
+
+// Pipeline runs inputs through a chain of stages where every stage has its
+// own workers and passes its results on to the next one. Build one with
+// [NewPipeline] and add stages with [Then].
+//
+//	p := parallel.NewPipeline(&cfg, parallel.Stage[string, []byte]{Name: "fetch", Job: fetch, Workers: 8})
+//	q := parallel.Then(p, parallel.Stage[[]byte, Record]{Name: "parse", Job: parse, Workers: 2})
+//	for rec, err := range q.Run(ctx, slices.Values(urls)) { ... }
+type Pipeline[In, Out any] struct {
+	cfg    JobConfig
+	stages []*stageStats
+	start  func(ctx context.Context, run *pipeRun, in <-chan pipeItem[In]) <-chan pipeItem[Out]
+}
+
+// NewPipeline creates a pipeline from its first stage. The config applies to
+// every job in the pipeline except for [JobConfig.MaxWorkers] which is set
+// per stage.
+func NewPipeline[In, Out any](config *JobConfig, first Stage[In, Out]) *Pipeline[In, Out] {
+	if config == nil {
+		config = new(JobConfig)
+	}
+	config.defaults()
+	p := &Pipeline[In, Out]{cfg: *config}
+	p.stages = []*stageStats{newStageStats(0, first.Name, first.Workers)}
+	p.start = func(ctx context.Context, run *pipeRun, in <-chan pipeItem[In]) <-chan pipeItem[Out] {
+		return runStage(ctx, run, 0, first, in)
+	}
+	return p
+}
+
+// Then returns a new pipeline that passes the results of p to another stage.
+// The metrics of the new pipeline start from zero.
+func Then[In, Mid, Out any](p *Pipeline[In, Mid], next Stage[Mid, Out]) *Pipeline[In, Out] {
+	k := len(p.stages)
+	q := &Pipeline[In, Out]{cfg: p.cfg, stages: make([]*stageStats, 0, k+1)}
+	for _, s := range p.stages {
+		q.stages = append(q.stages, &stageStats{name: s.name, workers: s.workers})
+	}
+	q.stages = append(q.stages, newStageStats(k, next.Name, next.Workers))
+	start := p.start
+	q.start = func(ctx context.Context, run *pipeRun, in <-chan pipeItem[In]) <-chan pipeItem[Out] {
+		return runStage(ctx, run, k, next, start(ctx, run, in))
+	}
+	return q
+}
+
+// Run sends every element of a sequence through the pipeline and yields the
+// results of the last stage. Results are yielded as they finish so they are
+// only in the order of the sequence when every stage has one worker.
+//
+// Errors are yielded as an [*IndexError] holding the position of the element
+// in the sequence and wrapping a [*StageError]. The first error cancels the
+// pipeline unless [JobConfig.CollectErrors] is set, in which case failed
+// elements are dropped and the rest carry on. Breaking out of the loop
+// cancels the pipeline and waits for every stage to stop.
+func (p *Pipeline[In, Out]) Run(ctx context.Context, seq iter.Seq[In]) iter.Seq2[Out, error] {
+	return func(yield func(Out, error) bool) {
+		ctx, cancel := p.cfg.context(ctx)
+		defer cancel()
+		run := &pipeRun{cfg: &p.cfg, stats: p.stages, errs: make(chan error)}
+		src := make(chan pipeItem[In])
+		go func() {
+			defer close(src)
+			i := 0
+			for in := range seq {
+				select {
+				case <-ctx.Done():
+					return
+				case src <- pipeItem[In]{i: i, v: in}:
+				}
+				i++
+			}
+		}()
+		// Every stage closes its output once its input is closed and its
+		// workers have returned, so the last output is closed after every
+		// goroutine of the run is done.
+		out := p.start(ctx, run, src)
+		defer func() {
+			cancel()
+			for range out {
+			}
+		}()
+		for {
+			select {
+			case r, ok := <-out:
+				if !ok {
+					if err := ctx.Err(); err != nil {
+						var zero Out
+						yield(zero, err)
+					}
+					return
+				}
+				if !yield(r.v, nil) {
+					return
+				}
+			case err := <-run.errs:
+				p.cfg.repanic(err)
+				var zero Out
+				if !yield(zero, err) || !p.cfg.CollectErrors {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Metrics returns the metrics of every stage in order.
+func (p *Pipeline[In, Out]) Metrics() []StageMetrics {
+	m := make([]StageMetrics, len(p.stages))
+	for i, s := range p.stages {
+		m[i] = StageMetrics{
+			Name:    s.name,
+			Workers: s.workers,
+			In:      s.in.Load(),
+			Out:     s.out.Load(),
+			Errors:  s.errors.Load(),
+			Busy:    time.Duration(s.busy.Load()),
+		}
+	}
+	return m
+}
+
+func newStageStats(k int, name string, workers int) *stageStats {
+	if name == "" {
+		name = fmt.Sprintf("stage %d", k)
+	}
+	return &stageStats{name: name, workers: max(workers, 1)}
+}
+
+// runStage starts the workers of stage k. Workers keep reading the input
+// after the context is done, without running the job, so that the previous
+// stage is never blocked and closes its output.
+func runStage[A, B any](
+	ctx context.Context,
+	run *pipeRun,
+	k int,
+	s Stage[A, B],
+	in <-chan pipeItem[A],
+) <-chan pipeItem[B] {
+	var (
+		wg    sync.WaitGroup
+		stats = run.stats[k]
+		out   = make(chan pipeItem[B], max(s.Buffer, 0))
+	)
+	wg.Add(stats.workers)
+	for range stats.workers {
+		go func() {
+			defer wg.Done()
+			for it := range in {
+				if ctx.Err() != nil {
+					continue
+				}
+				stats.in.Add(1)
+				start := time.Now()
+				v, err := call(ctx, run.cfg, it.i, it.v, func(ctx context.Context) (B, error) {
+					return s.Job(ctx, it.v)
+				})
+				stats.busy.Add(int64(time.Since(start)))
+				if err != nil {
+					stats.errors.Add(1)
+					err = &IndexError{Index: it.i, Err: &StageError{Stage: stats.name, Err: err}}
+					select {
+					case <-ctx.Done():
+					case run.errs <- err:
+					}
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case out <- pipeItem[B]{i: it.i, v: v}:
+					stats.out.Add(1)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,202 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrPoolClosed is returned when submitting to a [Pool] that has been shut
+	// down and by the futures of queued jobs that were dropped by [Pool.Stop].
+	ErrPoolClosed = errors.New("parallel: pool is closed")
+	// ErrQueueFull is returned by [Pool.Submit] when the queue is full and
+	// [JobConfig.RejectWhenFull] is set.
+	ErrQueueFull = errors.New("parallel: pool queue is full")
+)
+
+// Pool is a long-lived set of workers that run a job for every submitted
+// input. The number of workers is [JobConfig.MaxWorkers], or
+// [runtime.GOMAXPROCS] when it is zero, and up to [JobConfig.QueueSize] inputs
+// wait for a free worker. [JobConfig.Timeout] applies to each job.
+type Pool[In, Out any] struct {
+	cfg    JobConfig
+	job    Job[In, Out]
+	queue  chan *poolTask[In, Out]
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	next   atomic.Int64
+
+	// mu guards closed and is held for reading while sending on the queue so
+	// that it is not closed during a send.
+	mu     sync.RWMutex
+	closed bool
+}
+
+type poolTask[In, Out any] struct {
+	ctx context.Context
+	i   int
+	in  In
+	f   *Future[Out]
+}
+
+// NewPool starts the workers of a pool that runs job. The pool must be closed
+// with [Pool.Shutdown] or [Pool.Stop] to stop the workers.
+func NewPool[In, Out any](job Job[In, Out], config *JobConfig) *Pool[In, Out] {
+	if config == nil {
+		config = new(JobConfig)
+	}
+	config.defaults()
+	p := &Pool[In, Out]{
+		cfg:   *config,
+		job:   job,
+		queue: make(chan *poolTask[In, Out], max(config.QueueSize, 0)),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	workers := p.cfg.MaxWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p.wg.Add(workers)
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues an input and returns a future for the job's result. When the
+// queue is full Submit blocks until there is room or ctx is done, or returns
+// [ErrQueueFull] if [JobConfig.RejectWhenFull] is set.
+//
+// The job is run with ctx so cancelling it cancels the job. Use
+// [context.WithoutCancel] for jobs that should outlive the caller.
+func (p *Pool[In, Out]) Submit(ctx context.Context, in In) (*Future[Out], error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	t := &poolTask[In, Out]{
+		ctx: ctx,
+		i:   int(p.next.Add(1) - 1),
+		in:  in,
+		f:   newFuture[Out](&p.cfg),
+	}
+	if p.cfg.RejectWhenFull {
+		select {
+		case p.queue <- t:
+			return t.f, nil
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+	select {
+	case p.queue <- t:
+		return t.f, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, ErrPoolClosed
+	}
+}
+
+// Shutdown stops accepting new inputs and waits for every queued and running
+// job to finish. If ctx is done first then the remaining jobs are cancelled as
+// with [Pool.Stop] and the context's error is returned.
+func (p *Pool[In, Out]) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		// Closing waits for blocked calls to Submit which may only return
+		// once the queue has room, so it is done here to respect ctx.
+		p.close()
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.Stop()
+		return ctx.Err()
+	}
+}
+
+// Stop stops accepting new inputs, cancels running jobs, and drops queued
+// jobs. The futures of dropped jobs return [ErrPoolClosed]. Stop waits for
+// running jobs to return.
+func (p *Pool[In, Out]) Stop() {
+	// Cancel first so that blocked calls to Submit let go of the lock.
+	p.cancel()
+	p.close()
+	p.wg.Wait()
+}
+
+func (p *Pool[In, Out]) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+}
+
+func (p *Pool[In, Out]) work() {
+	defer p.wg.Done()
+	var zero Out
+	for t := range p.queue {
+		if p.ctx.Err() != nil {
+			t.f.complete(zero, ErrPoolClosed)
+			continue
+		}
+		if err := t.ctx.Err(); err != nil {
+			t.f.complete(zero, err)
+			continue
+		}
+		ctx, cancel := p.cfg.context(t.ctx)
+		stop := context.AfterFunc(p.ctx, cancel)
+		v, err := call(ctx, &p.cfg, t.i, t.in, func(ctx context.Context) (Out, error) {
+			return p.job(ctx, t.in)
+		})
+		stop()
+		cancel()
+		t.f.complete(v, err)
+	}
+}
+
+// Future is the result of a job submitted to a [Pool].
+type Future[T any] struct {
+	cfg  *JobConfig
+	done chan struct{}
+	v    T
+	err  error
+}
+
+func newFuture[T any](cfg *JobConfig) *Future[T] {
+	return &Future[T]{cfg: cfg, done: make(chan struct{})}
+}
+
+func (f *Future[T]) complete(v T, err error) {
+	f.v, f.err = v, err
+	close(f.done)
+}
+
+// Done is closed when the job has finished.
+func (f *Future[T]) Done() <-chan struct{} { return f.done }
+
+// Wait blocks until the job has finished or ctx is done and returns the job's
+// result. A panicking job panics again in Wait when [JobConfig.Panics] is
+// [PanicRepanic].
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		f.cfg.repanic(f.err)
+		return f.v, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package parallel
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter limits how often jobs are started. Wait blocks until a job may
+// start or returns an error if ctx is done first.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// RateLimiter is a token bucket [Limiter]. The bucket starts full and holds
+// up to burst tokens which are refilled at a fixed rate. Every job takes one
+// token. A RateLimiter can be shared by many [Ctrl], [Pool], and [Pipeline]
+// values so that they share the same budget.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // time to refill one token
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter creates a limiter that allows perSecond jobs per second with
+// bursts of up to burst jobs. A burst less than one is treated as one.
+// NewRateLimiter panics if perSecond is not a positive number. Leave
+// [JobConfig.Limiter] nil to run jobs without a limit.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if !(perSecond > 0) || math.IsInf(perSecond, 1) {
+		panic("parallel: NewRateLimiter rate must be a positive number")
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		burst:    float64(max(burst, 1)),
+		tokens:   float64(max(burst, 1)),
+		last:     time.Now(),
+	}
+}
+
+// Wait takes a token from the bucket, waiting for one to be refilled if it is
+// empty. The token is returned if ctx is done before it is available.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	l.last = now
+	// Reserve a token even if it has not been refilled yet so that waiting
+	// jobs are let through in order.
+	l.tokens--
+	wait := time.Duration(-l.tokens * float64(l.interval))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens = min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// limited waits on the limiter before calling fn.
+func limited[T any](l Limiter, fn func(context.Context) (T, error)) func(context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		if err := l.Wait(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		return fn(ctx)
+	}
+}
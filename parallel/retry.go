@@ -0,0 +1,69 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how failed jobs are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of times a job is run including the first
+	// attempt. Zero or one will never retry.
+	MaxAttempts int
+	// InitialBackoff is the time waited before the first retry. Defaults to
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time waited between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is how much the backoff grows after each retry. Defaults to
+	// 2.
+	Multiplier float64
+	// Jitter is the fraction of each backoff that is randomized, between 0
+	// and 1. A jitter of 0.5 waits somewhere between half of and the full
+	// backoff.
+	Jitter float64
+	// Retryable reports whether an error should be retried. When nil every
+	// error is retried except for context cancellation and deadline errors.
+	// A [*TimeoutError] from [JobConfig.JobTimeout] is retried even though it
+	// matches [context.DeadlineExceeded].
+	Retryable func(error) bool
+	// MaxElapsed caps the total time spent on a job including all retries.
+	// A retry is not started if its backoff would end after the cap. Zero
+	// means no cap.
+	MaxElapsed time.Duration
+}
+
+// Backoff returns the time to wait before retrying after the given failed
+// attempt, starting at 1.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return true
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
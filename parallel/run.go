@@ -0,0 +1,74 @@
+package parallel
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type result[T any] struct {
+	i   int
+	v   T
+	err error
+}
+
+// run calls fn for every index in [0, n) using a fixed number of worker
+// goroutines and sends each result on the returned channel. Calls are made
+// with [call] so they are retried and recovered, and input returns the job
+// input used in a [PanicError]. Workers stop taking new work once the context
+// is done and the channel is closed after every worker has exited.
+//
+// Callers must [wait] on the channel before returning so that no goroutines
+// outlive the call.
+func run[T any](
+	ctx context.Context,
+	cfg *JobConfig,
+	n int,
+	input func(i int) any,
+	fn func(ctx context.Context, i int) (T, error),
+) <-chan result[T] {
+	var (
+		wg      sync.WaitGroup
+		next    atomic.Int64
+		ch      = make(chan result[T])
+		workers = cfg.workers(n)
+	)
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				var in any
+				if input != nil {
+					in = input(i)
+				}
+				v, err := call(ctx, cfg, i, in, func(ctx context.Context) (T, error) {
+					return fn(ctx, i)
+				})
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- result[T]{i: i, v: v, err: err}:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// wait cancels the context of the workers sending on ch and blocks until they
+// have all exited. Jobs that are running are not interrupted so wait returns
+// once they notice the cancellation or finish.
+func wait[T any](cancel context.CancelFunc, ch <-chan result[T]) {
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,133 @@
+package parallel
+
+import (
+	"context"
+	"iter"
+	"runtime"
+	"sync"
+)
+
+// MapSeq applies a job to every element of a sequence in parallel. See
+// [Ctrl.MapSeq].
+func MapSeq[In, Out any](ctx context.Context, seq iter.Seq[In], job Job[In, Out]) iter.Seq2[Out, error] {
+	ctrl := NewCtrl[In, Out](nil)
+	return ctrl.MapSeq(ctx, seq, job)
+}
+
+// MapSeq applies a job to every element of a sequence in parallel and yields
+// the results. Elements are pulled from the sequence lazily so at most
+// [JobConfig.MaxWorkers] jobs run at a time and at most twice that many
+// elements are in flight, waiting to run or to be yielded. A MaxWorkers of
+// zero uses [runtime.GOMAXPROCS] workers.
+//
+// Results are yielded in the same order as the sequence unless
+// [JobConfig.Unordered] is set, in which case they are yielded as soon as
+// they finish. Errors are yielded as an [*IndexError] holding the position of
+// the element in the sequence. Iteration stops after the first error unless
+// [JobConfig.CollectErrors] is set.
+//
+// The sequence is consumed from another goroutine. Breaking out of the loop
+// cancels the remaining jobs and waits for running jobs to return.
+func (c *Ctrl[In, Out]) MapSeq(ctx context.Context, seq iter.Seq[In], job Job[In, Out]) iter.Seq2[Out, error] {
+	type task struct {
+		i  int
+		in In
+	}
+	return func(yield func(Out, error) bool) {
+		ctx, cancel := c.cfg.context(ctx)
+		defer cancel()
+		workers := c.cfg.MaxWorkers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		var (
+			wg      sync.WaitGroup
+			tasks   = make(chan task)
+			results = make(chan result[Out])
+			// Holds a slot for every element from the time it is pulled from
+			// the sequence until its result is yielded.
+			inflight = make(chan struct{}, 2*workers)
+		)
+		wg.Add(1 + workers)
+		go func() {
+			defer wg.Done()
+			defer close(tasks)
+			i := 0
+			for in := range seq {
+				select {
+				case <-ctx.Done():
+					return
+				case inflight <- struct{}{}:
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case tasks <- task{i: i, in: in}:
+				}
+				i++
+			}
+		}()
+		for range workers {
+			go func() {
+				defer wg.Done()
+				for t := range tasks {
+					v, err := call(ctx, &c.cfg, t.i, t.in, func(ctx context.Context) (Out, error) {
+						return job(ctx, t.in)
+					})
+					select {
+					case <-ctx.Done():
+						return
+					case results <- result[Out]{i: t.i, v: v, err: err}:
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		defer func() {
+			cancel()
+			for range results {
+			}
+		}()
+
+		// emit yields one result and reports whether iteration should go on.
+		emit := func(r result[Out]) bool {
+			<-inflight
+			c.cfg.repanic(r.err)
+			if r.err != nil {
+				return yield(r.v, &IndexError{Index: r.i, Err: r.err}) && c.cfg.CollectErrors
+			}
+			return yield(r.v, nil)
+		}
+		var (
+			next    int
+			pending = make(map[int]result[Out])
+		)
+		for r := range results {
+			if c.cfg.Unordered {
+				if !emit(r) {
+					return
+				}
+				continue
+			}
+			pending[r.i] = r
+			for {
+				p, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				if !emit(p) {
+					return
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			var zero Out
+			yield(zero, err)
+		}
+	}
+}
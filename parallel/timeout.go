@@ -0,0 +1,40 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutError is returned by a job that did not finish within
+// [JobConfig.JobTimeout]. It matches [context.DeadlineExceeded] with
+// [errors.Is].
+type TimeoutError struct {
+	// Index is the index of the job or of its input.
+	Index int
+	// Input is the input passed to the job. It is nil for a [BasicJob].
+	Input   any
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("parallel: job %d timed out after %v", e.Index, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// timed runs fn with a timeout and returns a [*TimeoutError] if it fails
+// after the timeout has passed. Failures caused by the parent context are
+// returned as is.
+func timed[T any](d time.Duration, i int, in any, fn func(context.Context) (T, error)) func(context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		timeout := &TimeoutError{Index: i, Input: in, Timeout: d}
+		ctx, cancel := context.WithTimeoutCause(ctx, d, timeout)
+		defer cancel()
+		v, err := fn(ctx)
+		if err != nil && context.Cause(ctx) == timeout {
+			return v, timeout
+		}
+		return v, err
+	}
+}
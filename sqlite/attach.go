@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Attachment is a database that is attached to every connection.
+type Attachment struct {
+	// Name is the schema name used to refer to the database in queries.
+	Name string
+	// Location is the file name or URI of the database.
+	Location string
+	// Pragmas are run against the attached schema after it is attached.
+	Pragmas map[string]any
+}
+
+// WithAttachment will ATTACH a database to every connection. Attached
+// databases are per-connection so they are attached as each new connection is
+// opened.
+func WithAttachment(name, location string, pragmas map[string]any) Option {
+	return func(c *Config) {
+		c.Attachments = append(c.Attachments, Attachment{
+			Name:     name,
+			Location: location,
+			Pragmas:  pragmas,
+		})
+	}
+}
+
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+// Attach will attach a database under a schema name. Attached databases only
+// exist on the connection that attached them so database should be a
+// [*sql.Conn] or a [*sql.Tx]. To attach a database to every connection in a
+// pool use [WithAttachment].
+func Attach(ctx context.Context, database execer, name, location string) error {
+	_, err := database.ExecContext(ctx, `ATTACH DATABASE ? AS ?`, location, name)
+	return errors.WithStack(err)
+}
+
+// Detach will detach a database that was previously attached.
+func Detach(ctx context.Context, database execer, name string) error {
+	_, err := database.ExecContext(ctx, `DETACH DATABASE ?`, name)
+	return errors.WithStack(err)
+}
+
+func (c *Config) attach(conn *sqlite3.SQLiteConn) error {
+	for _, a := range c.Attachments {
+		_, err := conn.Exec(`ATTACH DATABASE ? AS ?`, []driver.Value{a.Location, a.Name})
+		if err != nil {
+			return errors.Wrapf(err, "failed to attach %q as %q", a.Location, a.Name)
+		}
+		for name, value := range a.Pragmas {
+			query := fmt.Sprintf("PRAGMA %s.%s=%v", QuoteIdent(a.Name), name, value)
+			if c.Debug {
+				c.loggerOrDefault().Debug("executing pragma", "query", query)
+			}
+			if _, err = conn.Exec(query, nil); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestAttachments(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	dir := t.TempDir()
+	archive, err := File(filepath.Join(dir, "archive.db"))
+	is.NoErr(err)
+	_, err = archive.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO events (name) VALUES ('old')`)
+	is.NoErr(err)
+	is.NoErr(archive.Close())
+
+	d, err := File(
+		filepath.Join(dir, "hot.db"),
+		WithAttachment("archive", filepath.Join(dir, "archive.db"), map[string]any{
+			PragmaCacheSize: 123,
+		}),
+	)
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO events (name) VALUES ('new')`)
+	is.NoErr(err)
+
+	// Hold two connections open at the same time so that the attachment is
+	// checked on more than one connection.
+	c1, err := d.Conn(ctx)
+	is.NoErr(err)
+	defer c1.Close()
+	c2, err := d.Conn(ctx)
+	is.NoErr(err)
+	defer c2.Close()
+	for _, c := range []*sql.Conn{c1, c2} {
+		var names string
+		err = c.QueryRowContext(ctx, `
+			SELECT group_concat(name, ',') FROM (
+				SELECT name FROM main.events UNION ALL SELECT name FROM archive.events
+			)`).Scan(&names)
+		is.NoErr(err)
+		is.Equal(names, "new,old")
+		var size int
+		is.NoErr(c.QueryRowContext(ctx, `PRAGMA archive.cache_size`).Scan(&size))
+		is.Equal(size, 123)
+	}
+
+	is.NoErr(Detach(ctx, c1, "archive"))
+	is.NoErr(Attach(ctx, c1, "other", filepath.Join(dir, "other.db")))
+	var n int
+	is.NoErr(c1.QueryRowContext(ctx, `SELECT count(*) FROM pragma_database_list WHERE name IN ('other', 'archive')`).Scan(&n))
+	is.Equal(n, 1)
+
+	dsn, err := (&Config{Attachments: []Attachment{{Name: "archive", Location: "a.db"}}}).DSN("x.db")
+	is.NoErr(err)
+	is.Equal(dsn, "file:x.db?_attach_archive=a.db")
+	c, err := ParseDSN(dsn)
+	is.NoErr(err)
+	is.Equal(c.Attachments, []Attachment{{Name: "archive", Location: "a.db"}})
+}
@@ -0,0 +1,262 @@
+package sqlite
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ChangeOp is the type of operation that changed a row.
+type ChangeOp int
+
+const (
+	ChangeInsert ChangeOp = sqlite3.SQLITE_INSERT
+	ChangeUpdate ChangeOp = sqlite3.SQLITE_UPDATE
+	ChangeDelete ChangeOp = sqlite3.SQLITE_DELETE
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeInsert:
+		return "INSERT"
+	case ChangeUpdate:
+		return "UPDATE"
+	case ChangeDelete:
+		return "DELETE"
+	}
+	return ""
+}
+
+// Change is a single row that was inserted, updated, or deleted.
+type Change struct {
+	Op       ChangeOp
+	Database string
+	Table    string
+	RowID    int64
+}
+
+// ChangeFeed delivers row changes made through any database opened with
+// [WithChangeFeed] to its subscribers. Changes are buffered for each
+// connection and only delivered once the transaction that made them has
+// committed, so they are visible to other connections by the time they are
+// received. Changes made in a transaction or savepoint that is rolled back are
+// never delivered. Savepoints are tracked as their statements are prepared so
+// a SAVEPOINT, RELEASE, or ROLLBACK TO statement that is prepared once and run
+// many times is not supported.
+//
+// Because SQLite's update hook is used, changes to WITHOUT ROWID tables and
+// rows deleted by a truncating "DELETE FROM table" with no WHERE clause are
+// not reported.
+//
+// The feed uses the authorizer of every connection to track savepoints, which
+// adds a callback for each table and column a statement reads. Registering
+// another authorizer on one of these connections panics.
+type ChangeFeed struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func NewChangeFeed() *ChangeFeed {
+	return &ChangeFeed{subs: make(map[*subscription]struct{})}
+}
+
+// WithChangeFeed will publish all committed row changes to a [ChangeFeed].
+func WithChangeFeed(feed *ChangeFeed) Option { return func(c *Config) { c.Changes = feed } }
+
+// Subscribe returns a channel that receives every change committed after the
+// call to Subscribe. The channel is closed once the context is done.
+// Subscribers that fall behind never block writers, changes are queued until
+// they are received.
+func (f *ChangeFeed) Subscribe(ctx context.Context) <-chan Change {
+	s := &subscription{notify: make(chan struct{}, 1)}
+	out := make(chan Change)
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	go func() {
+		defer close(out)
+		defer func() {
+			f.mu.Lock()
+			delete(f.subs, s)
+			f.mu.Unlock()
+		}()
+		for {
+			for _, ch := range s.take() {
+				select {
+				case out <- ch:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-s.notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Changes returns an iterator over every change committed after the call to
+// Changes. Iteration stops when the context is done or the loop exits. The
+// iterator can only be used once and holds on to its subscription until the
+// context is done or the loop exits.
+func (f *ChangeFeed) Changes(ctx context.Context) iter.Seq[Change] {
+	ctx, cancel := context.WithCancel(ctx)
+	changes := f.Subscribe(ctx)
+	return func(yield func(Change) bool) {
+		defer cancel()
+		for ch := range changes {
+			if !yield(ch) {
+				return
+			}
+		}
+	}
+}
+
+func (f *ChangeFeed) publish(changes []Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		s.push(changes)
+	}
+}
+
+// hook registers the hooks that collect the changes made on a new
+// connection.
+func (f *ChangeFeed) hook(conn *sqlite3.SQLiteConn) *connChanges {
+	c := &connChanges{feed: f, conn: conn}
+	conn.RegisterUpdateHook(c.update)
+	conn.RegisterCommitHook(c.commit)
+	conn.RegisterRollbackHook(c.rollback)
+	conn.RegisterAuthorizer(c.authorize)
+	return c
+}
+
+// RegisterAuthorizer panics if the connection has a [ChangeFeed] because the
+// feed needs the authorizer to track savepoints. SQLite only has one
+// authorizer per connection.
+func (c *tracedConn) RegisterAuthorizer(callback func(int, string, string, string) int) {
+	if c.changes != nil {
+		panic("sqlite: the authorizer of a connection with a ChangeFeed cannot be replaced")
+	}
+	c.SQLiteConn.RegisterAuthorizer(callback)
+}
+
+// connChanges holds the changes made on one connection until they are known
+// to be committed. Hooks and driver calls on a connection are never called
+// concurrently.
+//
+// SQLite calls the commit hook before the commit is written and the commit
+// can still fail, so changes are only moved to committed by the hook. They
+// are published once a driver call returns and the connection is no longer
+// in a transaction. A failed commit either rolls back, which clears every
+// buffer, or leaves the transaction open.
+type connChanges struct {
+	feed       *ChangeFeed
+	conn       *sqlite3.SQLiteConn
+	pending    []Change
+	committed  []Change
+	savepoints []savepoint
+}
+
+// savepoint marks the number of pending changes when a savepoint was
+// started.
+type savepoint struct {
+	name string
+	n    int
+}
+
+func (c *connChanges) update(op int, database, table string, rowid int64) {
+	c.pending = append(c.pending, Change{
+		Op:       ChangeOp(op),
+		Database: database,
+		Table:    table,
+		RowID:    rowid,
+	})
+}
+
+func (c *connChanges) commit() int {
+	c.committed = append(c.committed, c.pending...)
+	c.pending = nil
+	c.savepoints = nil
+	return 0
+}
+
+func (c *connChanges) rollback() {
+	c.pending = nil
+	c.committed = nil
+	c.savepoints = nil
+}
+
+// authorize tracks savepoints because "ROLLBACK TO" does not call the
+// rollback hook. The authorizer runs when a statement is prepared, which is
+// right before it is run for anything other than a statement that is
+// prepared once and run many times.
+func (c *connChanges) authorize(op int, arg1, arg2, _ string) int {
+	// A new statement means an earlier commit has finished.
+	c.flush()
+	if op != sqlite3.SQLITE_SAVEPOINT {
+		return sqlite3.SQLITE_OK
+	}
+	switch arg1 {
+	case "BEGIN":
+		c.savepoints = append(c.savepoints, savepoint{name: arg2, n: len(c.pending)})
+	case "RELEASE", "ROLLBACK":
+		i := len(c.savepoints) - 1
+		for ; i >= 0; i-- {
+			if strings.EqualFold(c.savepoints[i].name, arg2) {
+				break
+			}
+		}
+		if i < 0 {
+			break
+		}
+		if arg1 == "RELEASE" {
+			c.savepoints = c.savepoints[:i]
+		} else {
+			// The savepoint stays open after rolling back to it.
+			c.pending = c.pending[:c.savepoints[i].n]
+			c.savepoints = c.savepoints[:i+1]
+		}
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// flush publishes committed changes once the connection has left the
+// transaction that committed them.
+func (c *connChanges) flush() {
+	if len(c.committed) == 0 || !c.conn.AutoCommit() {
+		return
+	}
+	c.feed.publish(c.committed)
+	c.committed = nil
+}
+
+type subscription struct {
+	mu     sync.Mutex
+	queue  []Change
+	notify chan struct{}
+}
+
+func (s *subscription) push(changes []Change) {
+	s.mu.Lock()
+	s.queue = append(s.queue, changes...)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) take() []Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queue
+	s.queue = nil
+	return q
+}
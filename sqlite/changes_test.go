@@ -0,0 +1,232 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestChangeFeed(t *testing.T) {
+	is := is.New(t)
+	feed := NewChangeFeed()
+	d, err := File(filepath.Join(t.TempDir(), "test.db"), WithChangeFeed(feed))
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE items (name TEXT)`)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	changes := feed.Subscribe(ctx)
+
+	// Rolled back changes should never be seen.
+	tx, err := d.Begin()
+	is.NoErr(err)
+	_, err = tx.Exec(`INSERT INTO items VALUES ('a')`)
+	is.NoErr(err)
+	is.NoErr(tx.Rollback())
+
+	tx, err = d.Begin()
+	is.NoErr(err)
+	_, err = tx.Exec(`INSERT INTO items VALUES ('b'), ('c')`)
+	is.NoErr(err)
+	select {
+	case ch := <-changes:
+		t.Fatalf("got change %+v before commit", ch)
+	case <-time.After(10 * time.Millisecond):
+	}
+	is.NoErr(tx.Commit())
+	_, err = d.Exec(`UPDATE items SET name = 'x' WHERE name = 'b'`)
+	is.NoErr(err)
+	_, err = d.Exec(`DELETE FROM items WHERE name = 'c'`)
+	is.NoErr(err)
+
+	got := make([]Change, 0, 4)
+	for len(got) < 4 {
+		got = append(got, <-changes)
+	}
+	is.Equal(got[0], Change{Op: ChangeInsert, Database: "main", Table: "items", RowID: 1})
+	is.Equal(got[1], Change{Op: ChangeInsert, Database: "main", Table: "items", RowID: 2})
+	is.Equal(got[2], Change{Op: ChangeUpdate, Database: "main", Table: "items", RowID: 1})
+	is.Equal(got[3], Change{Op: ChangeDelete, Database: "main", Table: "items", RowID: 2})
+	is.Equal(got[3].Op.String(), "DELETE")
+
+	seq := feed.Changes(ctx)
+	go d.Exec(`INSERT INTO items VALUES ('d')`)
+	for ch := range seq {
+		is.Equal(ch.Op, ChangeInsert)
+		break
+	}
+}
+
+func TestChangeFeed_Savepoint(t *testing.T) {
+	is := is.New(t)
+	feed := NewChangeFeed()
+	d, err := File(filepath.Join(t.TempDir(), "test.db"), WithChangeFeed(feed))
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE items (name TEXT)`)
+	is.NoErr(err)
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	changes := feed.Subscribe(ctx)
+
+	tx, err := d.Begin()
+	is.NoErr(err)
+	for _, q := range []string{
+		`INSERT INTO items VALUES ('a')`,
+		`SAVEPOINT sp`,
+		`INSERT INTO items VALUES ('b')`,
+		`SAVEPOINT inner`,
+		`INSERT INTO items VALUES ('c')`,
+		`ROLLBACK TO sp`,
+		`INSERT INTO items VALUES ('d')`,
+		`RELEASE sp`,
+	} {
+		_, err = tx.Exec(q)
+		is.NoErr(err)
+	}
+	is.NoErr(tx.Commit())
+	// Savepoints in a single call outside of a transaction.
+	_, err = d.Exec(`SAVEPOINT a;
+		INSERT INTO items VALUES ('e');
+		ROLLBACK TO a;
+		INSERT INTO items VALUES ('f');
+		RELEASE a`)
+	is.NoErr(err)
+
+	got := make([]int64, 0, 3)
+	for len(got) < 3 {
+		got = append(got, (<-changes).RowID)
+	}
+	// Rolled back rows ids are reused.
+	is.Equal(got, []int64{1, 2, 3})
+	var names string
+	is.NoErr(d.QueryRow(`SELECT group_concat(name) FROM items`).Scan(&names))
+	is.Equal(names, "a,d,f")
+	select {
+	case ch := <-changes:
+		t.Fatalf("got rolled back change %+v", ch)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestChangeFeed_FailedCommit(t *testing.T) {
+	is := is.New(t)
+	feed := NewChangeFeed()
+	file := filepath.Join(t.TempDir(), "test.db")
+	d, err := File(file, WithChangeFeed(feed))
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE items (name TEXT)`)
+	is.NoErr(err)
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	changes := feed.Subscribe(ctx)
+
+	// An open read transaction keeps the writer from committing.
+	reader, err := File(file)
+	is.NoErr(err)
+	defer reader.Close()
+	rtx, err := reader.Begin()
+	is.NoErr(err)
+	var n int
+	is.NoErr(rtx.QueryRow(`SELECT count(*) FROM items`).Scan(&n))
+
+	conn, err := d.Conn(ctx)
+	is.NoErr(err)
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, `PRAGMA busy_timeout = 10`)
+	is.NoErr(err)
+	tx, err := conn.BeginTx(ctx, nil)
+	is.NoErr(err)
+	_, err = tx.Exec(`INSERT INTO items VALUES ('a')`)
+	is.NoErr(err)
+	is.True(tx.Commit() != nil) // SQLITE_BUSY
+	select {
+	case ch := <-changes:
+		t.Fatalf("got change %+v from a failed commit", ch)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	is.NoErr(rtx.Rollback())
+	_, err = conn.ExecContext(ctx, `INSERT INTO items VALUES ('b')`)
+	is.NoErr(err)
+	ch := <-changes
+	is.Equal(ch.RowID, int64(1))
+	is.NoErr(d.QueryRow(`SELECT count(*) FROM items`).Scan(&n))
+	is.Equal(n, 1)
+}
+
+func TestChangeFeed_Visible(t *testing.T) {
+	is := is.New(t)
+	feed := NewChangeFeed()
+	file := filepath.Join(t.TempDir(), "test.db")
+	d, err := File(file, WithChangeFeed(feed), JournalMode("WAL"))
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE items (name TEXT)`)
+	is.NoErr(err)
+	reader, err := File(file)
+	is.NoErr(err)
+	defer reader.Close()
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	changes := feed.Subscribe(ctx)
+
+	// Subscribers re-reading a row from another connection should always
+	// see the committed change.
+	// Large rows make each commit slow to write.
+	const n = 20
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range n {
+			ch := <-changes
+			var found bool
+			err := reader.QueryRow(`SELECT count(*) > 0 FROM items WHERE rowid = ?`, ch.RowID).Scan(&found)
+			if err != nil || !found {
+				t.Errorf("change to row %d is not visible: %v", ch.RowID, err)
+			}
+		}
+	}()
+	for range n {
+		_, err = d.Exec(`INSERT INTO items VALUES (randomblob(1 << 22))`)
+		is.NoErr(err)
+	}
+	<-done
+}
+
+func TestChangeFeed_Authorizer(t *testing.T) {
+	is := is.New(t)
+	type authorizer interface {
+		RegisterAuthorizer(func(int, string, string, string) int)
+	}
+	register := func(d *sql.DB) (panicked bool) {
+		conn, err := d.Conn(t.Context())
+		is.NoErr(err)
+		defer conn.Close()
+		defer func() { panicked = recover() != nil }()
+		is.NoErr(conn.Raw(func(c any) error {
+			c.(authorizer).RegisterAuthorizer(func(int, string, string, string) int {
+				return sqlite3.SQLITE_OK
+			})
+			return nil
+		}))
+		return false
+	}
+	d, err := InMemory(WithChangeFeed(NewChangeFeed()))
+	is.NoErr(err)
+	defer d.Close()
+	is.True(register(d))
+
+	d, err = InMemory(Trace(true))
+	is.NoErr(err)
+	defer d.Close()
+	is.True(!register(d))
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -19,6 +20,24 @@ type Config struct {
 	Pragmas       map[string]any
 	Debug         bool
 
+	// Functions, Aggregates, and Collations are registered on every new
+	// connection.
+	Functions  []Function
+	Aggregates []Aggregate
+	Collations []Collation
+
+	// Trace will log every statement run against the database.
+	Trace bool
+	// SlowQueryThreshold will log statements that take longer than the
+	// threshold at warn level. Zero disables slow query logging.
+	SlowQueryThreshold time.Duration
+	// QueryHook is called after every statement run against the database.
+	QueryHook QueryHook
+	// Changes will receive all committed row changes.
+	Changes *ChangeFeed
+	// Attachments are attached to every new connection.
+	Attachments []Attachment
+
 	logger *slog.Logger
 }
 
@@ -27,7 +46,8 @@ type Option func(c *Config)
 // JournalMode sets the database's journal_mode pragma.
 func JournalMode(mode string) Option { return func(c *Config) { c.JournalMode = mode } }
 
-// WalCheckpoint sets the database's wal_checkpoint pragma.
+// WalCheckpoint sets the database's wal_checkpoint pragma. This only runs
+// once when the database is opened, see [Maintainer] for periodic checkpoints.
 func WalCheckpoint(n int) Option { return func(c *Config) { c.WalCheckpoint = &n } }
 
 // Pragma will add a database pragma.
@@ -86,7 +106,7 @@ func (c *Config) query() (url.Values, error) {
 	case CacheModePrivate:
 		q.Set("cache", "private")
 	default:
-		return q, errors.Errorf("invalid cache configuration %d", c.Cache)
+		return q, errors.Wrapf(ErrInvalidCacheMode, "invalid cache configuration %d", c.Cache)
 	}
 	if c.Debug {
 		c.loggerOrDefault().Debug("sqlite: database URI query built",
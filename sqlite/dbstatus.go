@@ -0,0 +1,75 @@
+//go:build cgo
+
+package sqlite
+
+/*
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_context sqlite3_context;
+typedef struct sqlite3_value sqlite3_value;
+
+// Provided by the SQLite library compiled into github.com/mattn/go-sqlite3.
+extern int sqlite3_db_status(sqlite3*, int, int*, int*, int);
+extern sqlite3 *sqlite3_context_db_handle(sqlite3_context*);
+extern int sqlite3_value_int(sqlite3_value*);
+extern void sqlite3_result_int64(sqlite3_context*, long long);
+extern void sqlite3_result_error_code(sqlite3_context*, int);
+extern int sqlite3_create_function_v2(sqlite3*, const char*, int, int, void*,
+	void (*)(sqlite3_context*, int, sqlite3_value**),
+	void (*)(sqlite3_context*, int, sqlite3_value**),
+	void (*)(sqlite3_context*),
+	void (*)(void*));
+extern int sqlite3_auto_extension(void (*)(void));
+
+#define SQLITE_UTF8 1
+#define SQLITE_DIRECTONLY 0x000080000
+
+static void db_status(sqlite3_context *ctx, int argc, sqlite3_value **argv) {
+	int cur = 0, hiwtr = 0;
+	int rc = sqlite3_db_status(sqlite3_context_db_handle(ctx), sqlite3_value_int(argv[0]), &cur, &hiwtr, 0);
+	if (rc != 0) {
+		sqlite3_result_error_code(ctx, rc);
+		return;
+	}
+	sqlite3_result_int64(ctx, cur);
+}
+
+// Set while this package opens a connection so that the auto extension
+// leaves connections opened by anyone else alone.
+static __thread int db_status_enabled;
+
+static void enable_db_status(int v) { db_status_enabled = v; }
+
+static int register_db_status(sqlite3 *db, char **err, const void *api) {
+	if (!db_status_enabled) {
+		return 0;
+	}
+	return sqlite3_create_function_v2(db, "db_status", 1, SQLITE_UTF8|SQLITE_DIRECTONLY,
+		0, db_status, 0, 0, 0);
+}
+
+static int auto_register_db_status(void) {
+	return sqlite3_auto_extension((void (*)(void))register_db_status);
+}
+*/
+import "C"
+
+import (
+	"database/sql/driver"
+	"runtime"
+	"sync"
+)
+
+var autoExtensionOnce sync.Once
+
+// withDBStatus calls open with the db_status SQL function enabled for the
+// connections it opens. go-sqlite3 does not expose sqlite3_db_status or the
+// connection handle it needs so the function is added by an auto extension,
+// which SQLite runs on the thread that opens the connection.
+func withDBStatus(open func() (driver.Conn, error)) (driver.Conn, error) {
+	autoExtensionOnce.Do(func() { C.auto_register_db_status() })
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	C.enable_db_status(1)
+	defer C.enable_db_status(0)
+	return open()
+}
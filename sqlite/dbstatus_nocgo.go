@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package sqlite
+
+import "database/sql/driver"
+
+// The db_status SQL function needs cgo so [Statistics.Cache] is always empty.
+func withDBStatus(open func() (driver.Conn, error)) (driver.Conn, error) { return open() }
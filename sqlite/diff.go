@@ -0,0 +1,466 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+// DiffKind describes how a schema object differs between two databases.
+type DiffKind uint8
+
+const (
+	DiffAdded DiffKind = iota + 1
+	DiffRemoved
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return ""
+}
+
+// SchemaDiff is a single difference between the schemas of two databases.
+type SchemaDiff struct {
+	Kind DiffKind
+	// Type is one of "table", "column", "index", "foreign key", or "check".
+	Type  string
+	Table string
+	// Name is the name of the column or index. Foreign keys are named by
+	// their columns and checks by their expression. For tables it is the
+	// same as Table.
+	Name string
+	// Old and New are the definitions of the object in the first and second
+	// databases. Old is empty for added objects and New is empty for removed
+	// objects.
+	Old, New string
+}
+
+func (d *SchemaDiff) String() string {
+	name := d.Name
+	if d.Type != "table" {
+		name = d.Table + "." + d.Name
+	}
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s %s %s", d.Type, name, d.New)
+	case DiffRemoved:
+		return fmt.Sprintf("- %s %s %s", d.Type, name, d.Old)
+	default:
+		return fmt.Sprintf("~ %s %s %s -> %s", d.Type, name, d.Old, d.New)
+	}
+}
+
+// Diff compares the schemas of two databases and reports the tables, columns,
+// indexes, foreign keys, and CHECK constraints that were added, removed, or
+// changed going from a to b. Columns, indexes, and foreign keys are compared
+// by their definitions as reported by PRAGMA table_info, PRAGMA index_xinfo,
+// and PRAGMA foreign_key_list rather than by the text of their CREATE
+// statements so that a schema built by a series of ALTER TABLE migrations
+// compares equal to the same schema created from scratch. CHECK constraints
+// have no pragma so they are read from the CREATE TABLE statement with their
+// whitespace collapsed.
+//
+// An empty result means the schemas are the same.
+func Diff(a, b db.DB) ([]SchemaDiff, error) {
+	ctx := context.Background()
+	sa, err := describeSchema(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := describeSchema(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]SchemaDiff, 0)
+	names := slices.Sorted(maps.Keys(sa))
+	for name := range sb {
+		if _, ok := sa[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		ta, inA := sa[name]
+		tb, inB := sb[name]
+		switch {
+		case !inA:
+			diffs = append(diffs, SchemaDiff{Kind: DiffAdded, Type: "table", Table: name, Name: name, New: tb.sql})
+		case !inB:
+			diffs = append(diffs, SchemaDiff{Kind: DiffRemoved, Type: "table", Table: name, Name: name, Old: ta.sql})
+		default:
+			sub := diffDefinitions(name, "column", ta.columns, tb.columns)
+			sub = append(sub, diffDefinitions(name, "index", ta.indexes, tb.indexes)...)
+			sub = append(sub, diffDefinitions(name, "foreign key", ta.foreignKeys, tb.foreignKeys)...)
+			sub = append(sub, diffDefinitions(name, "check", ta.checks, tb.checks)...)
+			if len(sub) == 0 && ta.options == tb.options {
+				continue
+			}
+			diffs = append(diffs, SchemaDiff{Kind: DiffChanged, Type: "table", Table: name, Name: name, Old: ta.sql, New: tb.sql})
+			diffs = append(diffs, sub...)
+		}
+	}
+	return diffs, nil
+}
+
+func diffDefinitions(table, typ string, a, b map[string]string) []SchemaDiff {
+	names := slices.Sorted(maps.Keys(a))
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	var diffs []SchemaDiff
+	for _, name := range names {
+		oldDef, inA := a[name]
+		newDef, inB := b[name]
+		d := SchemaDiff{Type: typ, Table: table, Name: name, Old: oldDef, New: newDef}
+		switch {
+		case !inA:
+			d.Kind = DiffAdded
+		case !inB:
+			d.Kind = DiffRemoved
+		case oldDef != newDef:
+			d.Kind = DiffChanged
+		default:
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+type tableDescription struct {
+	sql         string
+	options     string
+	columns     map[string]string
+	indexes     map[string]string
+	foreignKeys map[string]string
+	checks      map[string]string
+}
+
+func describeSchema(ctx context.Context, database db.DB) (map[string]*tableDescription, error) {
+	objects, err := listSchema(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]*tableDescription)
+	for _, obj := range objects {
+		if obj.Type != "table" || obj.kind == "shadow" {
+			continue
+		}
+		desc := tableDescription{
+			sql:         obj.SQL,
+			columns:     make(map[string]string),
+			indexes:     make(map[string]string),
+			foreignKeys: make(map[string]string),
+			checks:      make(map[string]string),
+		}
+		if obj.noRowID {
+			desc.options = "WITHOUT ROWID"
+		}
+		columns, err := tableColumns(ctx, database, obj.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range columns {
+			desc.columns[c.Name] = c.String()
+		}
+		if err = describeIndexes(ctx, database, obj.Name, desc.indexes); err != nil {
+			return nil, err
+		}
+		if err = describeForeignKeys(ctx, database, obj.Name, desc.foreignKeys); err != nil {
+			return nil, err
+		}
+		for _, check := range checkConstraints(obj.SQL) {
+			desc.checks[check] = check
+		}
+		tables[obj.Name] = &desc
+	}
+	return tables, nil
+}
+
+type indexDescription struct {
+	name, origin, sql string
+	unique, partial   bool
+}
+
+func describeIndexes(ctx context.Context, database db.DB, table string, dst map[string]string) error {
+	rows, err := database.QueryContext(ctx, `
+		SELECT l.name, l."unique", l.origin, l.partial, coalesce(s.sql, '')
+		FROM pragma_index_list(?) AS l
+		LEFT JOIN sqlite_schema AS s ON s.type = 'index' AND s.name = l.name`,
+		table,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	indexes := make([]indexDescription, 0)
+	for rows.Next() {
+		var ix indexDescription
+		err = rows.Scan(&ix.name, &ix.unique, &ix.origin, &ix.partial, &ix.sql)
+		if err != nil {
+			rows.Close()
+			return errors.WithStack(err)
+		}
+		indexes = append(indexes, ix)
+	}
+	if err = rows.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, ix := range indexes {
+		columns, err := indexColumns(ctx, database, ix.name)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if ix.unique {
+			b.WriteString("UNIQUE ")
+		}
+		fmt.Fprintf(&b, "(%s)", strings.Join(columns, ", "))
+		if ix.partial {
+			// The WHERE clause of a partial index is only available from the
+			// original CREATE INDEX statement.
+			if i := strings.LastIndex(strings.ToUpper(ix.sql), " WHERE "); i >= 0 {
+				b.WriteString(" WHERE ")
+				b.WriteString(strings.Join(strings.Fields(ix.sql[i+7:]), " "))
+			}
+		}
+		if ix.origin != "c" {
+			fmt.Fprintf(&b, " origin=%s", ix.origin)
+		}
+		dst[ix.name] = b.String()
+	}
+	return nil
+}
+
+func indexColumns(ctx context.Context, database db.DB, index string) ([]string, error) {
+	rows, err := database.QueryContext(ctx, `
+		SELECT coalesce(name, '<expr>'), coll, "desc"
+		FROM pragma_index_xinfo(?)
+		WHERE key = 1
+		ORDER BY seqno`,
+		index,
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	columns := make([]string, 0)
+	for rows.Next() {
+		var (
+			name, coll string
+			desc       bool
+		)
+		if err = rows.Scan(&name, &coll, &desc); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		col := name + " COLLATE " + coll
+		if desc {
+			col += " DESC"
+		}
+		columns = append(columns, col)
+	}
+	return columns, errors.WithStack(rows.Err())
+}
+
+type foreignKey struct {
+	from, to       []string
+	table          string
+	update, delete string
+	match          string
+}
+
+// describeForeignKeys adds the foreign keys of a table to dst keyed by their
+// columns.
+func describeForeignKeys(ctx context.Context, database db.DB, table string, dst map[string]string) error {
+	rows, err := database.QueryContext(ctx, `
+		SELECT id, "table", "from", coalesce("to", ''), on_update, on_delete, "match"
+		FROM pragma_foreign_key_list(?)
+		ORDER BY id, seq`,
+		table,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	keys := make(map[int]*foreignKey)
+	ids := make([]int, 0)
+	for rows.Next() {
+		var (
+			id       int
+			fk       foreignKey
+			from, to string
+		)
+		err = rows.Scan(&id, &fk.table, &from, &to, &fk.update, &fk.delete, &fk.match)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, ok := keys[id]; !ok {
+			keys[id] = &fk
+			ids = append(ids, id)
+		}
+		keys[id].from = append(keys[id].from, from)
+		if len(to) > 0 {
+			keys[id].to = append(keys[id].to, to)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, id := range ids {
+		fk := keys[id]
+		var b strings.Builder
+		fmt.Fprintf(&b, "REFERENCES %s", fk.table)
+		if len(fk.to) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(fk.to, ", "))
+		}
+		if fk.update != "NO ACTION" {
+			fmt.Fprintf(&b, " ON UPDATE %s", fk.update)
+		}
+		if fk.delete != "NO ACTION" {
+			fmt.Fprintf(&b, " ON DELETE %s", fk.delete)
+		}
+		if fk.match != "NONE" {
+			fmt.Fprintf(&b, " MATCH %s", fk.match)
+		}
+		name := "(" + strings.Join(fk.from, ", ") + ")"
+		if def, ok := dst[name]; ok {
+			// More than one foreign key on the same columns.
+			b.WriteString("; " + def)
+		}
+		dst[name] = b.String()
+	}
+	return nil
+}
+
+// checkConstraints returns the CHECK constraints of a CREATE TABLE statement,
+// both column and table constraints, with their whitespace collapsed so that
+// "CHECK(a>=0)" and "CHECK (a >= 0)" are the same.
+func checkConstraints(sql string) []string {
+	checks := make([]string, 0)
+	for i := 0; i < len(sql); i++ {
+		if end := skipLiteral(sql, i); end > i {
+			i = end - 1
+			continue
+		}
+		const keyword = "CHECK"
+		if !isKeyword(sql, i, keyword) {
+			continue
+		}
+		j := i + len(keyword)
+		for j < len(sql) && strings.IndexByte(" \t\r\n", sql[j]) >= 0 {
+			j++
+		}
+		if j >= len(sql) || sql[j] != '(' {
+			continue
+		}
+		end := closingParen(sql, j)
+		checks = append(checks, keyword+" "+collapseSpace(sql[j:end]))
+		i = end - 1
+	}
+	return checks
+}
+
+// collapseSpace removes whitespace and comments from an expression except for
+// a single space between words.
+func collapseSpace(sql string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(sql); i++ {
+		end := skipLiteral(sql, i)
+		isComment := end > i && (sql[i] == '-' || sql[i] == '/')
+		if isComment || strings.IndexByte(" \t\r\n", sql[i]) >= 0 {
+			space = true
+			i = max(i, end-1)
+			continue
+		}
+		if space && b.Len() > 0 {
+			last := b.String()[b.Len()-1]
+			if isIdentByte(last) && isIdentByte(sql[i]) {
+				b.WriteByte(' ')
+			}
+		}
+		space = false
+		if end > i {
+			b.WriteString(sql[i:end])
+			i = end - 1
+			continue
+		}
+		b.WriteByte(sql[i])
+	}
+	return b.String()
+}
+
+// closingParen returns the index after the parenthesis that closes the one at
+// sql[open] or the length of sql if it is never closed.
+func closingParen(sql string, open int) int {
+	depth := 0
+	for i := open; i < len(sql); i++ {
+		if end := skipLiteral(sql, i); end > i {
+			i = end - 1
+			continue
+		}
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// skipLiteral returns the index after the string, quoted identifier, or
+// comment that starts at sql[i]. It returns i if there is none.
+func skipLiteral(sql string, i int) int {
+	var end string
+	switch {
+	case sql[i] == '\'' || sql[i] == '"' || sql[i] == '`':
+		end = sql[i : i+1]
+	case sql[i] == '[':
+		end = "]"
+	case strings.HasPrefix(sql[i:], "--"):
+		end = "\n"
+	case strings.HasPrefix(sql[i:], "/*"):
+		end = "*/"
+	default:
+		return i
+	}
+	// Quotes are escaped by doubling them which is the same as ending one
+	// literal and starting another.
+	j := strings.Index(sql[i+1:], end)
+	if j < 0 {
+		return len(sql)
+	}
+	return i + 1 + j + len(end)
+}
+
+func isKeyword(sql string, i int, keyword string) bool {
+	if len(sql)-i < len(keyword) || !strings.EqualFold(sql[i:i+len(keyword)], keyword) {
+		return false
+	}
+	return (i == 0 || !isIdentByte(sql[i-1])) &&
+		(i+len(keyword) == len(sql) || !isIdentByte(sql[i+len(keyword)]))
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
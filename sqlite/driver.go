@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// connector opens the connections of one database. Each database gets its
+// own connector instead of a registered driver so that the functions,
+// tracing, and change feed of its config are released when it is closed.
+type connector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return withDBStatus(func() (driver.Conn, error) { return c.driver.Open(c.dsn) })
+}
+
+func (c *connector) Driver() driver.Driver { return c.driver }
+
+// newConnector returns a connector for the database at dsn. It takes a copy
+// of the config so that changes made after the database is opened don't
+// change the behavior of new connections.
+func (c *Config) newConnector(dsn string) driver.Connector {
+	snapshot := *c
+	return &connector{dsn: dsn, driver: snapshot.newDriver()}
+}
+
+func (c *Config) newDriver() driver.Driver {
+	d := &sqlite3.SQLiteDriver{ConnectHook: c.connect}
+	if !c.tracing() && c.Changes == nil {
+		return d
+	}
+	td := &tracingDriver{SQLiteDriver: d, changes: c.Changes}
+	if c.tracing() {
+		td.tracer = &tracer{
+			logger: c.loggerOrDefault(),
+			all:    c.Trace,
+			slow:   c.SlowQueryThreshold,
+			hook:   c.QueryHook,
+		}
+	}
+	return td
+}
+
+// connect is called for every new connection opened by the driver.
+func (c *Config) connect(conn *sqlite3.SQLiteConn) error {
+	if err := c.registerExtensions(conn); err != nil {
+		return err
+	}
+	if err := c.attach(conn); err != nil {
+		return err
+	}
+	return nil
+}
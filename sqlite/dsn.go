@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidJournalMode = errors.New("invalid journal mode")
+	ErrInvalidSynchronous = errors.New("invalid synchronous value")
+	ErrInvalidCacheMode   = errors.New("invalid cache mode")
+)
+
+// DSNError is returned when a DSN has an invalid parameter. It wraps one of
+// [ErrInvalidJournalMode], [ErrInvalidSynchronous], [ErrInvalidCacheMode], or
+// the error from parsing the value.
+type DSNError struct {
+	Param string
+	Value string
+	Err   error
+}
+
+func (e *DSNError) Error() string {
+	return fmt.Sprintf("sqlite: dsn parameter %s=%q: %v", e.Param, e.Value, e.Err)
+}
+
+func (e *DSNError) Unwrap() error { return e.Err }
+
+const (
+	dsnJournalMode   = "_journal_mode"
+	dsnWalCheckpoint = "_wal_checkpoint"
+	dsnDebug         = "_debug"
+	dsnTrace         = "_trace"
+	dsnSlowQuery     = "_slow_query"
+	dsnPragmaPrefix  = "_pragma_"
+	dsnAttachPrefix  = "_attach_"
+)
+
+// DSN returns a data source name for a database at location that can be
+// parsed by [ParseDSN] to get back the same config.
+//
+// SQLite URI parameters such as "cache" and "mode" are used where they
+// exist. All other fields are stored in parameters that start with an
+// underscore, like "_journal_mode=WAL". Pragmas are stored as
+// "_pragma_<name>=<value>" and attachments as "_attach_<name>=<location>".
+// Functions, aggregates, collations, query hooks, change feeds, and the
+// pragmas of attached databases cannot be stored in a DSN.
+func (c *Config) DSN(location string) (string, error) {
+	q, err := c.query()
+	if err != nil {
+		return "", err
+	}
+	if len(c.JournalMode) > 0 {
+		if err = validateJournalMode(c.JournalMode); err != nil {
+			return "", err
+		}
+		q.Set(dsnJournalMode, strings.ToUpper(c.JournalMode))
+	}
+	if c.WalCheckpoint != nil {
+		q.Set(dsnWalCheckpoint, strconv.Itoa(*c.WalCheckpoint))
+	}
+	if c.Debug {
+		q.Set(dsnDebug, "true")
+	}
+	if c.Trace {
+		q.Set(dsnTrace, "true")
+	}
+	if c.SlowQueryThreshold > 0 {
+		q.Set(dsnSlowQuery, c.SlowQueryThreshold.String())
+	}
+	for name, value := range c.Pragmas {
+		v := fmt.Sprint(value)
+		if name == PragmaSynchronous {
+			if _, err = ParseSynchronous(v); err != nil {
+				return "", err
+			}
+		}
+		q.Set(dsnPragmaPrefix+name, v)
+	}
+	for _, a := range c.Attachments {
+		q.Set(dsnAttachPrefix+a.Name, a.Location)
+	}
+	u := url.URL{Scheme: "file", Opaque: location, RawQuery: q.Encode()}
+	return u.String(), nil
+}
+
+// ParseDSN parses a data source name created by [Config.DSN].
+func ParseDSN(dsn string) (*Config, error) {
+	_, c, err := parseDSN(dsn)
+	return c, err
+}
+
+// OpenDSN parses a data source name created by [Config.DSN] and opens the
+// database it describes. Options are applied after the DSN is parsed.
+func OpenDSN(dsn string, opts ...Option) (*sql.DB, error) {
+	location, c, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return Open(location, c)
+}
+
+func parseDSN(dsn string) (string, *Config, error) {
+	location, rawQuery, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	var c Config
+	c.ReadOnly = q.Get("mode") == "ro"
+	if v := q.Get("cache"); len(v) > 0 {
+		if c.Cache, err = ParseCacheMode(v); err != nil {
+			return "", nil, err
+		}
+	}
+	if v := q.Get(dsnJournalMode); len(v) > 0 {
+		if err = validateJournalMode(v); err != nil {
+			return "", nil, err
+		}
+		c.JournalMode = strings.ToUpper(v)
+	}
+	if v := q.Get(dsnWalCheckpoint); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "", nil, &DSNError{Param: dsnWalCheckpoint, Value: v, Err: err}
+		}
+		c.WalCheckpoint = &n
+	}
+	for _, flag := range []struct {
+		param string
+		dst   *bool
+	}{
+		{dsnDebug, &c.Debug},
+		{dsnTrace, &c.Trace},
+	} {
+		v := q.Get(flag.param)
+		if len(v) == 0 {
+			continue
+		}
+		if *flag.dst, err = strconv.ParseBool(v); err != nil {
+			return "", nil, &DSNError{Param: flag.param, Value: v, Err: err}
+		}
+	}
+	if v := q.Get(dsnSlowQuery); len(v) > 0 {
+		if c.SlowQueryThreshold, err = time.ParseDuration(v); err != nil {
+			return "", nil, &DSNError{Param: dsnSlowQuery, Value: v, Err: err}
+		}
+	}
+	for key, values := range q {
+		if name, ok := strings.CutPrefix(key, dsnAttachPrefix); ok && len(values) > 0 {
+			c.Attachments = append(c.Attachments, Attachment{Name: name, Location: values[len(values)-1]})
+			continue
+		}
+		name, ok := strings.CutPrefix(key, dsnPragmaPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		value := values[len(values)-1]
+		if name == PragmaSynchronous {
+			if _, err = ParseSynchronous(value); err != nil {
+				return "", nil, err
+			}
+		}
+		if c.Pragmas == nil {
+			c.Pragmas = make(map[string]any)
+		}
+		if n, err := strconv.Atoi(value); err == nil {
+			c.Pragmas[name] = n
+		} else {
+			c.Pragmas[name] = value
+		}
+	}
+	slices.SortFunc(c.Attachments, func(a, b Attachment) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return location, &c, nil
+}
+
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+func validateJournalMode(mode string) error {
+	if slices.Contains(journalModes, strings.ToUpper(mode)) {
+		return nil
+	}
+	return &DSNError{Param: dsnJournalMode, Value: mode, Err: ErrInvalidJournalMode}
+}
+
+// ParseSynchronous parses the name or number of a synchronous setting.
+func ParseSynchronous(s string) (Synchronous, error) {
+	for sync := SynchronousOff; sync <= SynchronousExtra; sync++ {
+		if strings.EqualFold(s, sync.String()) || s == strconv.Itoa(int(sync)) {
+			return sync, nil
+		}
+	}
+	return 0, &DSNError{Param: dsnPragmaPrefix + PragmaSynchronous, Value: s, Err: ErrInvalidSynchronous}
+}
+
+// ParseCacheMode parses the value of a "cache" URI parameter.
+func ParseCacheMode(s string) (CacheMode, error) {
+	switch strings.ToLower(s) {
+	case "shared":
+		return CacheModeShared, nil
+	case "private":
+		return CacheModePrivate, nil
+	}
+	return CacheModeNone, &DSNError{Param: "cache", Value: s, Err: ErrInvalidCacheMode}
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+func TestDSN(t *testing.T) {
+	is := is.New(t)
+	c := Config{
+		ReadOnly:           true,
+		Cache:              CacheModeShared,
+		JournalMode:        "wal",
+		WalCheckpoint:      ptr(7),
+		Debug:              true,
+		Trace:              true,
+		SlowQueryThreshold: 250 * time.Millisecond,
+	}
+	WithSynchronous(SynchronousNormal)(&c)
+	WithPragma(PragmaCacheSize, 69)(&c)
+	dsn, err := c.DSN("/tmp/test.db")
+	is.NoErr(err)
+	is.Equal(dsn, "file:/tmp/test.db?"+
+		"_debug=true&_journal_mode=WAL&_pragma_cache_size=69&_pragma_synchronous=NORMAL&"+
+		"_slow_query=250ms&_trace=true&_wal_checkpoint=7&cache=shared&immutable=true&mode=ro")
+
+	parsed, err := ParseDSN(dsn)
+	is.NoErr(err)
+	c.JournalMode = "WAL"
+	is.Equal(*parsed.WalCheckpoint, 7)
+	parsed.WalCheckpoint = c.WalCheckpoint
+	is.Equal(*parsed, c)
+	again, err := parsed.DSN("/tmp/test.db")
+	is.NoErr(err)
+	is.Equal(again, dsn)
+}
+
+func TestParseDSN_Errors(t *testing.T) {
+	is := is.New(t)
+	for dsn, target := range map[string]error{
+		"file:x.db?_journal_mode=nope":       ErrInvalidJournalMode,
+		"file:x.db?_pragma_synchronous=fast": ErrInvalidSynchronous,
+		"file:x.db?cache=everything":         ErrInvalidCacheMode,
+	} {
+		_, err := ParseDSN(dsn)
+		is.True(errors.Is(err, target))
+		var dsnErr *DSNError
+		is.True(errors.As(err, &dsnErr))
+	}
+	_, err := ParseDSN("file:x.db?_slow_query=soon")
+	var dsnErr *DSNError
+	is.True(errors.As(err, &dsnErr))
+	is.Equal(dsnErr.Param, "_slow_query")
+	_, err = (&Config{JournalMode: "fast"}).DSN("x.db")
+	is.True(errors.Is(err, ErrInvalidJournalMode))
+	_, err = (&Config{Cache: 10}).DSN("x.db")
+	is.True(errors.Is(err, ErrInvalidCacheMode))
+}
+
+func TestOpenDSN(t *testing.T) {
+	is := is.New(t)
+	dsn, err := (&Config{JournalMode: "truncate"}).DSN(filepath.Join(t.TempDir(), "test.db"))
+	is.NoErr(err)
+	d, err := OpenDSN(dsn)
+	is.NoErr(err)
+	defer d.Close()
+	mode, err := GetJournalMode(db.Simple(d))
+	is.NoErr(err)
+	is.Equal(mode, "truncate")
+}
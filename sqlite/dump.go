@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+type dumpOptions struct {
+	data bool
+}
+
+type DumpOption func(*dumpOptions)
+
+// DumpData will include INSERT statements for every row of every table in
+// the dump.
+func DumpData(o *dumpOptions) { o.data = true }
+
+// Dump writes a SQL dump of the database schema to w, similar to the sqlite3
+// shell's .dump command. Tables and indexes are written in name order and
+// table rows are written in rowid order so that dumping the same database
+// twice will produce the same output.
+//
+// Virtual tables are dumped as CREATE VIRTUAL TABLE statements but their data
+// is never dumped.
+func Dump(database db.DB, w io.Writer, opts ...DumpOption) error {
+	var o dumpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx := context.Background()
+	objects, err := listSchema(ctx, database)
+	if err != nil {
+		return err
+	}
+	var tables, indexes, others []*schemaObject
+	for _, obj := range objects {
+		switch obj.Type {
+		case "table":
+			if obj.kind == "shadow" {
+				continue
+			}
+			tables = append(tables, obj)
+		case "index":
+			indexes = append(indexes, obj)
+		default:
+			others = append(others, obj)
+		}
+	}
+	byName := func(a, b *schemaObject) int { return strings.Compare(a.Name, b.Name) }
+	slices.SortFunc(tables, byName)
+	slices.SortFunc(indexes, byName)
+
+	out := bufio.NewWriter(w)
+	out.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n")
+	for _, t := range tables {
+		fmt.Fprintf(out, "%s;\n", t.SQL)
+		if !o.data || t.kind == "virtual" {
+			continue
+		}
+		if err = dumpRows(ctx, database, out, t); err != nil {
+			return err
+		}
+	}
+	if o.data {
+		if err = dumpSequences(ctx, database, out); err != nil {
+			return err
+		}
+	}
+	for _, obj := range indexes {
+		fmt.Fprintf(out, "%s;\n", obj.SQL)
+	}
+	for _, obj := range others {
+		fmt.Fprintf(out, "%s;\n", obj.SQL)
+	}
+	out.WriteString("COMMIT;\n")
+	return errors.WithStack(out.Flush())
+}
+
+type schemaObject struct {
+	Type    string
+	Name    string
+	Table   string
+	SQL     string
+	kind    string // type reported by table_list, "shadow", "virtual", etc.
+	noRowID bool
+}
+
+// listSchema returns all the user defined objects in the main schema in the
+// order that they were created.
+func listSchema(ctx context.Context, database db.DB) ([]*schemaObject, error) {
+	rows, err := database.QueryContext(ctx, `
+		SELECT s.type, s.name, s.tbl_name, s.sql,
+			coalesce(t.type, ''), coalesce(t.wr, 0)
+		FROM sqlite_schema AS s
+		LEFT JOIN pragma_table_list AS t
+			ON t.schema = 'main' AND t.name = s.name
+		WHERE s.sql IS NOT NULL AND s.name NOT LIKE 'sqlite_%'
+		ORDER BY s.rowid`)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	objects := make([]*schemaObject, 0)
+	for rows.Next() {
+		var obj schemaObject
+		err = rows.Scan(&obj.Type, &obj.Name, &obj.Table, &obj.SQL, &obj.kind, &obj.noRowID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		objects = append(objects, &obj)
+	}
+	return objects, errors.WithStack(rows.Err())
+}
+
+func dumpRows(ctx context.Context, database db.DB, w io.Writer, table *schemaObject) error {
+	columns, err := tableColumns(ctx, database, table.Name)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	names := make([]string, len(columns))
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = QuoteIdent(c.Name)
+		quoted[i] = "quote(" + names[i] + ")"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), QuoteIdent(table.Name))
+	if table.noRowID {
+		query += " ORDER BY " + strings.Join(names, ", ")
+	} else {
+		query += " ORDER BY rowid"
+	}
+	rows, err := database.QueryContext(ctx, query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	var (
+		values = make([]string, len(columns))
+		dst    = make([]any, len(columns))
+		prefix = fmt.Sprintf("INSERT INTO %s(%s) VALUES(", QuoteIdent(table.Name), strings.Join(names, ","))
+	)
+	for i := range values {
+		dst[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dst...); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err = fmt.Fprintf(w, "%s%s);\n", prefix, strings.Join(values, ",")); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(rows.Err())
+}
+
+func dumpSequences(ctx context.Context, database db.DB, w io.Writer) error {
+	rows, err := database.QueryContext(ctx,
+		`SELECT count(*) FROM sqlite_schema WHERE name = 'sqlite_sequence'`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var n int
+	if err = db.ScanOne(rows, &n); err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return nil
+	}
+	rows, err = database.QueryContext(ctx,
+		`SELECT quote(name), quote(seq) FROM sqlite_sequence ORDER BY name`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	first := true
+	for rows.Next() {
+		var name, seq string
+		if err = rows.Scan(&name, &seq); err != nil {
+			return errors.WithStack(err)
+		}
+		if first {
+			io.WriteString(w, "DELETE FROM sqlite_sequence;\n")
+			first = false
+		}
+		fmt.Fprintf(w, "INSERT INTO sqlite_sequence(name,seq) VALUES(%s,%s);\n", name, seq)
+	}
+	return errors.WithStack(rows.Err())
+}
+
+// Column is a table column as reported by PRAGMA table_info.
+type Column struct {
+	Index      int
+	Name       string
+	Type       string
+	NotNull    bool
+	Default    *string
+	PrimaryKey int
+}
+
+func (c *Column) String() string {
+	var b strings.Builder
+	b.WriteString(c.Type)
+	if c.NotNull {
+		b.WriteString(" NOT NULL")
+	}
+	if c.Default != nil {
+		b.WriteString(" DEFAULT ")
+		b.WriteString(*c.Default)
+	}
+	if c.PrimaryKey > 0 {
+		fmt.Fprintf(&b, " PRIMARY KEY(%d)", c.PrimaryKey)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func tableColumns(ctx context.Context, database db.DB, table string) ([]Column, error) {
+	rows, err := database.QueryContext(ctx,
+		`SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`,
+		table,
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	columns := make([]Column, 0)
+	for rows.Next() {
+		var c Column
+		err = rows.Scan(&c.Index, &c.Name, &c.Type, &c.NotNull, &c.Default, &c.PrimaryKey)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		columns = append(columns, c)
+	}
+	return columns, errors.WithStack(rows.Err())
+}
+
+// QuoteIdent quotes an SQL identifier such as a table or column name.
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+func TestDump(t *testing.T) {
+	is := is.New(t)
+	d, err := File(filepath.Join(t.TempDir(), "test.db"))
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`
+	CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		data BLOB,
+		score REAL DEFAULT 0
+	);
+	CREATE INDEX users_name_idx ON users (name);
+	CREATE TABLE a (x);
+	INSERT INTO users (name, data, score) VALUES
+		('jim', NULL, 1.5),
+		('it''s', x'0102', 2);
+	INSERT INTO a VALUES (1)`)
+	is.NoErr(err)
+
+	var schema, full bytes.Buffer
+	is.NoErr(Dump(db.Simple(d), &schema))
+	is.Equal(schema.String(), `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE a (x);
+CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		data BLOB,
+		score REAL DEFAULT 0
+	);
+CREATE INDEX users_name_idx ON users (name);
+COMMIT;
+`)
+	is.NoErr(Dump(db.Simple(d), &full, DumpData))
+	is.True(strings.Contains(full.String(), `INSERT INTO "a"("x") VALUES(1);`))
+	is.True(strings.Contains(full.String(),
+		`INSERT INTO "users"("id","name","data","score") VALUES(2,'it''s',X'0102',2.0);`))
+	is.True(strings.Contains(full.String(), "INSERT INTO sqlite_sequence(name,seq) VALUES('users',2);"))
+
+	// Restoring the dump should produce an identical database.
+	restored, err := File(filepath.Join(t.TempDir(), "restored.db"))
+	is.NoErr(err)
+	defer restored.Close()
+	_, err = restored.Exec(full.String())
+	is.NoErr(err)
+	var again bytes.Buffer
+	is.NoErr(Dump(db.Simple(restored), &again, DumpData))
+	is.Equal(again.String(), full.String())
+}
+
+func TestDiff(t *testing.T) {
+	is := is.New(t)
+	fresh, err := File(filepath.Join(t.TempDir(), "fresh.db"))
+	is.NoErr(err)
+	defer fresh.Close()
+	migrated, err := File(filepath.Join(t.TempDir(), "migrated.db"))
+	is.NoErr(err)
+	defer migrated.Close()
+
+	_, err = fresh.Exec(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+	CREATE UNIQUE INDEX users_email ON users (email)`)
+	is.NoErr(err)
+	_, err = migrated.Exec(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+	ALTER TABLE users ADD COLUMN email TEXT;
+	CREATE UNIQUE INDEX users_email ON users (email)`)
+	is.NoErr(err)
+
+	diff, err := Diff(db.Simple(fresh), db.Simple(migrated))
+	is.NoErr(err)
+	is.Equal(len(diff), 0)
+
+	_, err = migrated.Exec(`
+	ALTER TABLE users ADD COLUMN age INT;
+	DROP INDEX users_email;
+	CREATE INDEX users_email ON users (email DESC);
+	CREATE TABLE posts (id INTEGER PRIMARY KEY)`)
+	is.NoErr(err)
+	diff, err = Diff(db.Simple(fresh), db.Simple(migrated))
+	is.NoErr(err)
+	is.Equal(len(diff), 4)
+	is.Equal(diff[0].Kind, DiffAdded)
+	is.Equal(diff[0].Type, "table")
+	is.Equal(diff[0].Name, "posts")
+	is.Equal(diff[1].Kind, DiffChanged)
+	is.Equal(diff[1].Type, "table")
+	is.Equal(diff[1].Name, "users")
+	is.Equal(diff[2].Kind, DiffAdded)
+	is.Equal(diff[2].Type, "column")
+	is.Equal(diff[2].Name, "age")
+	is.Equal(diff[2].New, "INT")
+	is.Equal(diff[3].Kind, DiffChanged)
+	is.Equal(diff[3].Type, "index")
+	is.Equal(diff[3].Old, "UNIQUE (email COLLATE BINARY)")
+	is.Equal(diff[3].New, "(email COLLATE BINARY DESC)")
+	is.Equal(diff[3].String(), "~ index users.users_email UNIQUE (email COLLATE BINARY) -> (email COLLATE BINARY DESC)")
+}
+
+func TestDiff_Constraints(t *testing.T) {
+	is := is.New(t)
+	open := func(schema string) db.DB {
+		d, err := InMemory()
+		is.NoErr(err)
+		t.Cleanup(func() { d.Close() })
+		_, err = d.Exec(schema)
+		is.NoErr(err)
+		return db.Simple(d)
+	}
+	fresh := open(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY, age INT CHECK (age >= 0));
+	CREATE TABLE posts (
+		id        INTEGER PRIMARY KEY,
+		author_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+		title     TEXT,
+		CONSTRAINT title_length CHECK (length(title) <= 100)
+	)`)
+
+	// The same constraints added by migrations.
+	migrated := open(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY);
+	ALTER TABLE users ADD COLUMN age INT CHECK(age>=0);
+	CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, CHECK (length(title) <= 100));
+	ALTER TABLE posts ADD COLUMN author_id INTEGER REFERENCES users (id) ON DELETE CASCADE`)
+	diff, err := Diff(fresh, migrated)
+	is.NoErr(err)
+	is.Equal(len(diff), 0)
+
+	// A migration that forgot the foreign key and changed a check.
+	migrated = open(`
+	CREATE TABLE users (id INTEGER PRIMARY KEY, age INT CHECK (age > 0));
+	CREATE TABLE posts (
+		id        INTEGER PRIMARY KEY,
+		author_id INTEGER,
+		title     TEXT CHECK (length(title) <= 100) -- CHECK (ignored)
+	)`)
+	diff, err = Diff(fresh, migrated)
+	is.NoErr(err)
+	is.Equal(len(diff), 5)
+	is.Equal(diff[0].Kind, DiffChanged)
+	is.Equal(diff[0].Name, "posts")
+	is.Equal(diff[1].String(), "- foreign key posts.(author_id) REFERENCES users (id) ON DELETE CASCADE")
+	is.Equal(diff[2].Kind, DiffChanged)
+	is.Equal(diff[2].Name, "users")
+	is.Equal(diff[3].String(), "+ check users.CHECK (age>0) CHECK (age>0)")
+	is.Equal(diff[4].String(), "- check users.CHECK (age>=0) CHECK (age>=0)")
+}
@@ -0,0 +1,230 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/harrybrwn/db"
+	"github.com/harrybrwn/x/text"
+	"github.com/pkg/errors"
+)
+
+// CleanTextFunc is the name of the SQL function registered by
+// [WithCleanText].
+const CleanTextFunc = "clean_text"
+
+// WithCleanText registers a SQL function named "clean_text" that removes
+// accents from text using [text.Clean]. It is required on every connection
+// that writes to an [FTS5] table with Normalize set.
+func WithCleanText() Option {
+	return WithFunction(CleanTextFunc, cleanText, true)
+}
+
+func cleanText(s string) string {
+	clean, err := text.Clean(s)
+	if err != nil {
+		return s
+	}
+	return clean
+}
+
+// FTS5 describes a full-text search table.
+//
+// FTS5 is an optional SQLite extension. Programs using it must be built with
+// the "sqlite_fts5" build tag.
+type FTS5 struct {
+	// Table is the name of the virtual table.
+	Table string
+	// Columns are the indexed columns. When Content is set these must be
+	// columns of the content table.
+	Columns []string
+	// Content is the name of an external content table. When set, the virtual
+	// table only stores the index and triggers are created on the content
+	// table to keep the index up to date.
+	Content string
+	// ContentRowID is the integer primary key of the content table. Defaults
+	// to "rowid".
+	ContentRowID string
+	// Tokenize is the tokenizer and its arguments, e.g. "porter unicode61".
+	Tokenize string
+	// Normalize will remove accents from indexed text and queries using
+	// [text.Clean] so that "café" matches "cafe". Indexed text is passed
+	// through the "clean_text" SQL function so the database must be opened
+	// with [WithCleanText]. Tables without external content must have their
+	// text cleaned before it is inserted.
+	Normalize bool
+}
+
+// Create creates the virtual table if it does not exist. For external content
+// tables the sync triggers are also created and any rows already in the
+// content table are indexed.
+func (f *FTS5) Create(ctx context.Context, database db.DB) error {
+	exists, err := QueryOne[bool](ctx, database,
+		`SELECT count(*) > 0 FROM sqlite_schema WHERE type = 'table' AND name = ?`, f.Table)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	var b strings.Builder
+	args := make([]string, 0, len(f.Columns)+3)
+	for _, c := range f.Columns {
+		args = append(args, QuoteIdent(c))
+	}
+	if len(f.Content) > 0 {
+		args = append(args,
+			"content="+quoteString(f.Content),
+			"content_rowid="+quoteString(f.contentRowID()))
+	}
+	if len(f.Tokenize) > 0 {
+		args = append(args, "tokenize="+quoteString(f.Tokenize))
+	}
+	fmt.Fprintf(&b, "CREATE VIRTUAL TABLE %s USING fts5(%s);\n",
+		QuoteIdent(f.Table), strings.Join(args, ", "))
+	if len(f.Content) > 0 {
+		f.writeTriggers(&b)
+		fmt.Fprintf(&b, "INSERT INTO %s (rowid, %s) SELECT %s, %s FROM %s;\n",
+			QuoteIdent(f.Table), f.columnList("", false),
+			QuoteIdent(f.contentRowID()), f.columnList("", true),
+			QuoteIdent(f.Content))
+	}
+	_, err = database.ExecContext(ctx, b.String())
+	return errors.WithStack(err)
+}
+
+func (f *FTS5) writeTriggers(b *strings.Builder) {
+	var (
+		table   = QuoteIdent(f.Table)
+		content = QuoteIdent(f.Content)
+		rowid   = QuoteIdent(f.contentRowID())
+		cols    = f.columnList("", false)
+		insert  = fmt.Sprintf("INSERT INTO %s (rowid, %s) VALUES (new.%s, %s);",
+			table, cols, rowid, f.columnList("new.", true))
+		remove = fmt.Sprintf("INSERT INTO %s (%s, rowid, %s) VALUES ('delete', old.%s, %s);",
+			table, table, cols, rowid, f.columnList("old.", true))
+	)
+	for _, t := range []struct{ suffix, event, body string }{
+		{"ai", "INSERT", insert},
+		{"ad", "DELETE", remove},
+		{"au", "UPDATE", remove + "\n\t" + insert},
+	} {
+		fmt.Fprintf(b, "CREATE TRIGGER IF NOT EXISTS %s AFTER %s ON %s BEGIN\n\t%s\nEND;\n",
+			QuoteIdent(f.Table+"_"+t.suffix), t.event, content, t.body)
+	}
+}
+
+// columnList joins the indexed columns with a prefix like "new.". When clean
+// is true and the table is normalized each column is passed through the
+// clean_text function.
+func (f *FTS5) columnList(prefix string, clean bool) string {
+	cols := make([]string, len(f.Columns))
+	for i, c := range f.Columns {
+		cols[i] = prefix + QuoteIdent(c)
+		if clean && f.Normalize {
+			cols[i] = CleanTextFunc + "(" + cols[i] + ")"
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (f *FTS5) contentRowID() string {
+	if len(f.ContentRowID) == 0 {
+		return "rowid"
+	}
+	return f.ContentRowID
+}
+
+// Match builds an FTS5 query string from user input. Each word is quoted so
+// that FTS5 syntax in the input is matched literally, and all words must be
+// present for a row to match. If prefix is true the last word will also match
+// any word it is a prefix of, which is useful for search-as-you-type.
+func Match(input string, prefix bool) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+	}
+	if prefix && len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// SearchOptions control the results returned by [FTS5.Search].
+type SearchOptions struct {
+	// Column is the index of the column used for snippets and highlights.
+	Column int
+	// Open and Close surround matched terms. Defaults to "<b>" and "</b>".
+	Open, Close string
+	// Ellipsis is added where a snippet is truncated. Defaults to "...".
+	Ellipsis string
+	// Tokens is the max number of tokens in a snippet. Defaults to 16.
+	Tokens int
+	// Weights are the bm25 weights of each column.
+	Weights []float64
+	// Prefix lets the last word of the query match as a prefix.
+	Prefix bool
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a row matched by [FTS5.Search].
+type SearchResult struct {
+	RowID int64 `db:"rowid"`
+	// Score is the bm25 score of the row. Lower scores are better matches.
+	Score float64 `db:"score"`
+	// Snippet is a short fragment of the column with matches highlighted.
+	Snippet string `db:"snippet"`
+	// Highlight is the full column with matches highlighted.
+	Highlight string `db:"highlight"`
+}
+
+// Search finds rows matching the user input ordered by rank. The input is
+// turned into a query with [Match].
+func (f *FTS5) Search(ctx context.Context, database db.DB, input string, opts *SearchOptions) iter.Seq2[SearchResult, error] {
+	var o SearchOptions
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.Open) == 0 && len(o.Close) == 0 {
+		o.Open, o.Close = "<b>", "</b>"
+	}
+	if len(o.Ellipsis) == 0 {
+		o.Ellipsis = "..."
+	}
+	if o.Tokens <= 0 {
+		o.Tokens = 16
+	}
+	if o.Limit <= 0 {
+		o.Limit = -1
+	}
+	if f.Normalize {
+		input = cleanText(input)
+	}
+	table := QuoteIdent(f.Table)
+	bm25 := []string{table}
+	for _, w := range o.Weights {
+		bm25 = append(bm25, strconv.FormatFloat(w, 'g', -1, 64))
+	}
+	query := fmt.Sprintf(`SELECT
+			rowid,
+			bm25(%[2]s) AS score,
+			snippet(%[1]s, ?2, ?3, ?4, ?5, ?6) AS snippet,
+			highlight(%[1]s, ?2, ?3, ?4) AS highlight
+		FROM %[1]s
+		WHERE %[1]s MATCH ?1
+		ORDER BY score
+		LIMIT ?7 OFFSET ?8`, table, strings.Join(bm25, ", "))
+	return Query[SearchResult](ctx, database, query,
+		Match(input, o.Prefix), o.Column, o.Open, o.Close, o.Ellipsis, o.Tokens, o.Limit, o.Offset)
+}
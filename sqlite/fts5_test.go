@@ -0,0 +1,71 @@
+//go:build sqlite_fts5 || fts5
+
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+func TestFTS5(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	d, err := InMemory(WithCleanText())
+	is.NoErr(err)
+	defer d.Close()
+	d.SetMaxOpenConns(1)
+	_, err = d.Exec(`CREATE TABLE docs (id INTEGER PRIMARY KEY, title TEXT, body TEXT);
+		INSERT INTO docs (title, body) VALUES
+			('Café menu', 'Coffee and crêpes served all day'),
+			('Tea', 'Green tea and black tea')`)
+	is.NoErr(err)
+	database := db.Simple(d)
+	fts := FTS5{
+		Table:        "docs_fts",
+		Columns:      []string{"title", "body"},
+		Content:      "docs",
+		ContentRowID: "id",
+		Tokenize:     "unicode61",
+		Normalize:    true,
+	}
+	is.NoErr(fts.Create(ctx, database))
+	is.NoErr(fts.Create(ctx, database)) // already exists
+
+	search := func(q string, opts *SearchOptions) []SearchResult {
+		t.Helper()
+		var res []SearchResult
+		for r, err := range fts.Search(ctx, database, q, opts) {
+			is.NoErr(err)
+			res = append(res, r)
+		}
+		return res
+	}
+	// Existing rows are indexed and accents are ignored.
+	res := search("cafe", nil)
+	is.Equal(len(res), 1)
+	is.Equal(res[0].RowID, int64(1))
+	is.Equal(res[0].Highlight, "<b>Café</b> menu")
+	is.True(res[0].Score < 0)
+
+	// Triggers keep the index in sync.
+	_, err = d.Exec(`INSERT INTO docs (title, body) VALUES ('Crêpes', 'Sweet crêpes with café au lait')`)
+	is.NoErr(err)
+	res = search("crepes", &SearchOptions{Column: 1, Open: "[", Close: "]"})
+	is.Equal(len(res), 2)
+	is.Equal(res[0].Snippet, "Sweet [crêpes] with café au lait")
+	res = search("cre", &SearchOptions{Prefix: true, Weights: []float64{10, 1}})
+	is.Equal(len(res), 2)
+	is.Equal(res[0].RowID, int64(3)) // title match is weighted higher
+
+	_, err = d.Exec(`UPDATE docs SET title = 'Drinks' WHERE id = 2`)
+	is.NoErr(err)
+	is.Equal(len(search("drinks", nil)), 1)
+	_, err = d.Exec(`DELETE FROM docs WHERE id = 1`)
+	is.NoErr(err)
+	is.Equal(len(search("coffee", nil)), 0)
+
+	// Query syntax in user input is matched literally.
+	is.Equal(len(search(`tea" OR "coffee`, nil)), 0)
+}
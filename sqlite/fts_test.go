@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestMatch(t *testing.T) {
+	is := is.New(t)
+	for _, tt := range []struct {
+		in     string
+		prefix bool
+		want   string
+	}{
+		{"", false, ""},
+		{"hello world", false, `"hello" "world"`},
+		{`a"b OR NOT c*`, false, `"a""b" "OR" "NOT" "c*"`},
+		{"  sear  ", true, `"sear"*`},
+		{"title:x (y)", true, `"title:x" "(y)"*`},
+	} {
+		is.Equal(Match(tt.in, tt.prefix), tt.want)
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	is := is.New(t)
+	d, err := File(filepath.Join(t.TempDir(), "db"), WithCleanText(), JournalMode("WAL"))
+	is.NoErr(err)
+	defer d.Close()
+
+	// The function is called from every pooled connection at once.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				var s string
+				if err := d.QueryRow(`SELECT clean_text(?)`, "Crème Brûlée").Scan(&s); err != nil {
+					t.Error(err)
+					return
+				}
+				if s != "Creme Brulee" {
+					t.Errorf("expected \"Creme Brulee\", got %q", s)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
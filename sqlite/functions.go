@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/harrybrwn/x/text"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Function is a scalar SQL function implemented in Go.
+//
+// See [sqlite3.SQLiteConn.RegisterFunc] for the types of functions that are
+// supported.
+type Function struct {
+	Name string
+	Impl any
+	// Pure should be set if the function always returns the same result given
+	// the same inputs. This lets SQLite use the function in indexes.
+	Pure bool
+}
+
+// Aggregate is an aggregate SQL function implemented in Go. Impl is a
+// constructor for a type with Step and Done methods.
+//
+// See [sqlite3.SQLiteConn.RegisterAggregator] for more details.
+type Aggregate struct {
+	Name string
+	Impl any
+	Pure bool
+}
+
+// Collation is a named collating sequence used to compare text values.
+type Collation struct {
+	Name    string
+	Compare func(a, b string) int
+}
+
+// WithFunction registers a scalar SQL function on every connection.
+func WithFunction(name string, impl any, pure bool) Option {
+	return func(c *Config) {
+		c.Functions = append(c.Functions, Function{Name: name, Impl: impl, Pure: pure})
+	}
+}
+
+// WithAggregate registers an aggregate SQL function on every connection.
+func WithAggregate(name string, impl any, pure bool) Option {
+	return func(c *Config) {
+		c.Aggregates = append(c.Aggregates, Aggregate{Name: name, Impl: impl, Pure: pure})
+	}
+}
+
+// WithCollation registers a collating sequence on every connection. Using the
+// name of a built-in collation such as "NOCASE" will replace it.
+func WithCollation(name string, compare func(a, b string) int) Option {
+	return func(c *Config) {
+		c.Collations = append(c.Collations, Collation{Name: name, Compare: compare})
+	}
+}
+
+// UnicodeNoCase is a replacement for SQLite's built-in NOCASE collation that
+// ignores case for all of unicode rather than just ASCII. Accents are also
+// ignored by removing them with [text.Clean] so "Café" and "cafe" are equal.
+//
+//	sqlite.WithCollation("NOCASE", sqlite.UnicodeNoCase)
+func UnicodeNoCase(a, b string) int {
+	return strings.Compare(foldString(a), foldString(b))
+}
+
+func foldString(s string) string {
+	clean, err := text.Clean(s)
+	if err != nil {
+		clean = s
+	}
+	return strings.ToLower(clean)
+}
+
+func (c *Config) registerExtensions(conn *sqlite3.SQLiteConn) error {
+	for _, f := range c.Functions {
+		if err := conn.RegisterFunc(f.Name, f.Impl, f.Pure); err != nil {
+			return errors.Wrapf(err, "failed to register function %q", f.Name)
+		}
+	}
+	for _, a := range c.Aggregates {
+		if err := conn.RegisterAggregator(a.Name, a.Impl, a.Pure); err != nil {
+			return errors.Wrapf(err, "failed to register aggregate %q", a.Name)
+		}
+	}
+	for _, col := range c.Collations {
+		if err := conn.RegisterCollation(col.Name, col.Compare); err != nil {
+			return errors.Wrapf(err, "failed to register collation %q", col.Name)
+		}
+	}
+	return nil
+}
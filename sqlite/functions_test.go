@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type sumLengths struct{ n int }
+
+func (s *sumLengths) Step(v string) { s.n += len(v) }
+func (s *sumLengths) Done() int     { return s.n }
+
+func TestExtensions(t *testing.T) {
+	is := is.New(t)
+	config := Config{}
+	for _, o := range []Option{
+		WithFunction("reverse", func(s string) string {
+			r := []rune(s)
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			return string(r)
+		}, true),
+		WithAggregate("sum_lengths", func() *sumLengths { return new(sumLengths) }, true),
+		WithCollation("NOCASE", UnicodeNoCase),
+	} {
+		o(&config)
+	}
+	d, err := Open(":memory:", &config)
+	is.NoErr(err)
+	defer d.Close()
+
+	var s string
+	is.NoErr(d.QueryRow(`SELECT reverse('abc')`).Scan(&s))
+	is.Equal(s, "cba")
+	_, err = d.Exec(`CREATE TABLE words (w TEXT COLLATE NOCASE);
+		INSERT INTO words VALUES ('Café'), ('CAFE'), ('ÉCOLE'), ('ecole'), ('b')`)
+	is.NoErr(err)
+	var n int
+	is.NoErr(d.QueryRow(`SELECT sum_lengths(w) FROM words`).Scan(&n))
+	is.Equal(n, 5+4+6+5+1)
+	is.NoErr(d.QueryRow(`SELECT count(*) FROM words WHERE w = 'cafe'`).Scan(&n))
+	is.Equal(n, 2)
+	is.NoErr(d.QueryRow(`SELECT count(DISTINCT w) FROM words`).Scan(&n))
+	is.Equal(n, 3)
+
+	// The same config can open more databases.
+	d2, err := Open(":memory:", &config)
+	is.NoErr(err)
+	defer d2.Close()
+	is.NoErr(d2.QueryRow(`SELECT reverse('xyz')`).Scan(&s))
+	is.Equal(s, "zyx")
+
+	d3, err := InMemory()
+	is.NoErr(err)
+	defer d3.Close()
+	is.True(d3.QueryRow(`SELECT reverse('abc')`).Scan(&s) != nil)
+}
+
+func TestOpen_NoDriverRegistered(t *testing.T) {
+	is := is.New(t)
+	before := len(sql.Drivers())
+	add := func(n int) Option {
+		return WithFunction("add_n", func(v int) int { return v + n }, true)
+	}
+	for n := range 10 {
+		d, err := InMemory(add(n), WithChangeFeed(NewChangeFeed()), Trace(true))
+		is.NoErr(err)
+		// Every database has its own functions.
+		var v int
+		is.NoErr(d.QueryRow(`SELECT add_n(1)`).Scan(&v))
+		is.Equal(v, n+1)
+		is.NoErr(d.Close())
+	}
+	is.Equal(len(sql.Drivers()), before)
+}
+
+func TestUnicodeNoCase_Concurrent(t *testing.T) {
+	is := is.New(t)
+	d, err := Open(t.TempDir()+"/db", &Config{
+		JournalMode: "WAL",
+		Collations:  []Collation{{Name: "NOCASE", Compare: UnicodeNoCase}},
+	})
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`CREATE TABLE words (w TEXT COLLATE NOCASE)`)
+	is.NoErr(err)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				_, err := d.Exec(`INSERT INTO words VALUES (?)`, fmt.Sprintf("Café %d %d", i, j))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var n int
+				err = d.QueryRow(`SELECT count(*) FROM words WHERE w = ?`, fmt.Sprintf("CAFE %d %d", i, j)).Scan(&n)
+				if err != nil || n != 1 {
+					t.Errorf("expected one match, got %d and %v", n, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
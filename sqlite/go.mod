@@ -1,12 +1,18 @@
 module github.com/harrybrwn/x/sqlite
 
-go 1.24.0
+go 1.24.1
 
 require (
 	github.com/harrybrwn/db v0.0.2-0.20250123064507-e7bcb4fd9363
+	github.com/harrybrwn/x/parallel v0.0.0-20250705224516-e544c3130c2e
+	github.com/harrybrwn/x/text v0.0.0-20250705224516-e544c3130c2e
 	github.com/matryer/is v1.4.1
 	github.com/mattn/go-sqlite3 v1.14.24
 	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/lib/pq v1.11.2 // indirect
+require (
+	github.com/lib/pq v1.11.2 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+// JSON stores a value in a TEXT column as json. It can be used as a query
+// argument and scanned from a column.
+//
+//	var doc sqlite.JSON[Document]
+//	err := db.QueryRow(`SELECT doc FROM docs WHERE id = ?`, id).Scan(&doc)
+type JSON[T any] struct {
+	V T
+}
+
+// NewJSON wraps a value so that it is stored as json.
+func NewJSON[T any](v T) JSON[T] { return JSON[T]{V: v} }
+
+// Value implements [driver.Valuer].
+func (j JSON[T]) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return string(b), nil
+}
+
+// Scan implements [database/sql.Scanner]. NULL is scanned as the zero value.
+func (j *JSON[T]) Scan(src any) error {
+	var zero T
+	j.V = zero
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return errors.WithStack(json.Unmarshal([]byte(src), &j.V))
+	case []byte:
+		return errors.WithStack(json.Unmarshal(src, &j.V))
+	default:
+		return errors.Errorf("sqlite: cannot scan %T into JSON[%T]", src, zero)
+	}
+}
+
+func (j JSON[T]) MarshalJSON() ([]byte, error)  { return json.Marshal(j.V) }
+func (j *JSON[T]) UnmarshalJSON(b []byte) error { return json.Unmarshal(b, &j.V) }
+
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// JSONPath builds a json path from object keys and array indexes. Keys that
+// are not plain identifiers are quoted.
+//
+//	JSONPath("user", "tags", 0)  // $.user.tags[0]
+//	JSONPath("first name")       // $."first name"
+func JSONPath(elems ...any) string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, e := range elems {
+		switch e := e.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		case string:
+			if plainKey.MatchString(e) {
+				b.WriteString("." + e)
+			} else {
+				b.WriteString(`."` + e + `"`)
+			}
+		default:
+			fmt.Fprintf(&b, ".%v", e)
+		}
+	}
+	return b.String()
+}
+
+// JSONExtract returns a json_extract expression for a path in a column.
+//
+//	JSONExtract("doc", JSONPath("user", "name"))  // json_extract("doc", '$.user.name')
+func JSONExtract(column, path string) string {
+	return fmt.Sprintf("json_extract(%s, %s)", QuoteIdent(column), quoteString(path))
+}
+
+// JSONColumn is a generated column holding the value at a json path of
+// another column. Indexing the column makes queries on the path fast.
+type JSONColumn struct {
+	Table string
+	// Name is the name of the generated column.
+	Name string
+	// Source is the column holding the json document.
+	Source string
+	// Path is the json path of the value, see [JSONPath].
+	Path string
+	// Type is the column type, e.g. "TEXT" or "INTEGER".
+	Type string
+	// Index will create an index on the column named "<table>_<name>".
+	Index bool
+	// Unique makes the index unique.
+	Unique bool
+}
+
+// Create adds the generated column to the table and creates its index. It
+// does nothing for parts that already exist.
+//
+// Columns added to an existing table must be VIRTUAL so the value is
+// computed when read, or read from the index when one is used.
+func (c *JSONColumn) Create(ctx context.Context, database db.DB) error {
+	exists, err := QueryOne[bool](ctx, database,
+		`SELECT count(*) > 0 FROM pragma_table_xinfo(?) WHERE name = ?`, c.Table, c.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = database.ExecContext(ctx, fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s GENERATED ALWAYS AS (%s) VIRTUAL",
+			QuoteIdent(c.Table),
+			strings.TrimSpace(QuoteIdent(c.Name)+" "+c.Type),
+			JSONExtract(c.Source, c.Path),
+		))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if !c.Index {
+		return nil
+	}
+	unique := ""
+	if c.Unique {
+		unique = "UNIQUE "
+	}
+	_, err = database.ExecContext(ctx, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+		unique, QuoteIdent(c.Table+"_"+c.Name), QuoteIdent(c.Table), QuoteIdent(c.Name)))
+	return errors.WithStack(err)
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+func TestJSONPath(t *testing.T) {
+	is := is.New(t)
+	is.Equal(JSONPath(), "$")
+	is.Equal(JSONPath("user", "tags", 0), "$.user.tags[0]")
+	is.Equal(JSONPath("first name", 2, "x"), `$."first name"[2].x`)
+	is.Equal(JSONExtract("doc", "$.it's"), `json_extract("doc", '$.it''s')`)
+}
+
+func TestJSON(t *testing.T) {
+	type profile struct {
+		Email string   `json:"email"`
+		Age   int      `json:"age"`
+		Tags  []string `json:"tags"`
+	}
+	is := is.New(t)
+	ctx := t.Context()
+	d, err := File(filepath.Join(t.TempDir(), "json.db"))
+	is.NoErr(err)
+	defer d.Close()
+	database := db.Simple(d)
+	_, err = d.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, profile TEXT)`)
+	is.NoErr(err)
+	_, err = d.Exec(`INSERT INTO users (profile) VALUES (?), (?), (NULL)`,
+		NewJSON(profile{Email: "a@example.com", Age: 30, Tags: []string{"admin"}}),
+		NewJSON(profile{Email: "b@example.com", Age: 20}),
+	)
+	is.NoErr(err)
+
+	email := JSONColumn{
+		Table:  "users",
+		Name:   "email",
+		Source: "profile",
+		Path:   JSONPath("email"),
+		Type:   "TEXT",
+		Index:  true,
+		Unique: true,
+	}
+	is.NoErr(email.Create(ctx, database))
+	is.NoErr(email.Create(ctx, database)) // already exists
+
+	type user struct {
+		ID      int
+		Email   *string
+		Profile JSON[profile]
+	}
+	u, err := QueryOne[user](ctx, database, `SELECT id, email, profile FROM users WHERE email = ?`, "a@example.com")
+	is.NoErr(err)
+	is.Equal(u.ID, 1)
+	is.Equal(u.Profile.V.Tags, []string{"admin"})
+	u, err = QueryOne[user](ctx, database, `SELECT id, email, profile FROM users WHERE id = 3`)
+	is.NoErr(err)
+	is.Equal(u.Email, nil)
+	is.Equal(u.Profile.V, profile{})
+
+	var plan []string
+	for row, err := range Query[struct {
+		ID      int
+		Parent  int
+		NotUsed int `db:"notused"`
+		Detail  string
+	}](ctx, database, `EXPLAIN QUERY PLAN SELECT id FROM users WHERE email = ?`, "x") {
+		is.NoErr(err)
+		plan = append(plan, row.Detail)
+	}
+	is.True(strings.Contains(strings.Join(plan, "\n"), "users_email"))
+
+	age, err := QueryOne[int](ctx, database,
+		`SELECT `+JSONExtract("profile", JSONPath("age"))+` FROM users WHERE id = 2`)
+	is.NoErr(err)
+	is.Equal(age, 20)
+
+	_, err = d.Exec(`INSERT INTO users (profile) VALUES (?)`, NewJSON(profile{Email: "a@example.com"}))
+	is.True(err != nil) // unique index
+}
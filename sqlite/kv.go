@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned when a key does not exist or has expired.
+var ErrKeyNotFound = errors.New("sqlite: key not found")
+
+// Codec is used to encode and decode values stored in a [KV].
+type Codec[V any] interface {
+	Marshal(V) ([]byte, error)
+	Unmarshal([]byte, *V) error
+}
+
+// JSONCodec encodes values as json.
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(v V) ([]byte, error)    { return json.Marshal(v) }
+func (JSONCodec[V]) Unmarshal(b []byte, v *V) error { return json.Unmarshal(b, v) }
+
+type kvConfig[V any] struct {
+	codec     Codec[V]
+	batchSize int
+	now       func() time.Time
+}
+
+const defaultSweepBatchSize = 1000
+
+// KVOption configures a [KV].
+type KVOption[V any] func(*kvConfig[V])
+
+// WithCodec sets the codec used to store values. The default is [JSONCodec].
+func WithCodec[V any](c Codec[V]) KVOption[V] { return func(kc *kvConfig[V]) { kc.codec = c } }
+
+// WithSweepBatchSize sets the max number of expired keys deleted in a single
+// statement when sweeping. The default is 1000, which is also used when n is
+// less than one.
+func WithSweepBatchSize[V any](n int) KVOption[V] {
+	return func(kc *kvConfig[V]) { kc.batchSize = n }
+}
+
+// KV is a persistent map stored in a table.
+type KV[K ~string, V any] struct {
+	db    *sql.DB
+	table string
+	cfg   kvConfig[V]
+}
+
+// Entry is a key and value stored in a [KV].
+type Entry[K ~string, V any] struct {
+	Key   K
+	Value V
+	// ExpiresAt is the zero time if the key does not expire.
+	ExpiresAt time.Time
+}
+
+// NewKV creates a key value store in a table, creating the table if it does
+// not exist.
+func NewKV[K ~string, V any](ctx context.Context, database *sql.DB, table string, opts ...KVOption[V]) (*KV[K, V], error) {
+	kv := KV[K, V]{
+		db:    database,
+		table: QuoteIdent(table),
+		cfg: kvConfig[V]{
+			codec:     JSONCodec[V]{},
+			batchSize: defaultSweepBatchSize,
+			now:       time.Now,
+		},
+	}
+	for _, o := range opts {
+		o(&kv.cfg)
+	}
+	if kv.cfg.batchSize <= 0 {
+		kv.cfg.batchSize = defaultSweepBatchSize
+	}
+	_, err := database.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			key        TEXT PRIMARY KEY,
+			value      BLOB NOT NULL,
+			expires_at INTEGER
+		) WITHOUT ROWID;
+		CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (expires_at)
+			WHERE expires_at IS NOT NULL`,
+		kv.table, QuoteIdent(table+"_expires_at"),
+	))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &kv, nil
+}
+
+// Get returns the value stored at key or [ErrKeyNotFound].
+func (kv *KV[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var v V
+	b, err := QueryOne[[]byte](ctx, db.Simple(kv.db), fmt.Sprintf(
+		`SELECT value FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		kv.table), string(key), kv.now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrKeyNotFound
+	}
+	if err != nil {
+		return v, err
+	}
+	err = kv.cfg.codec.Unmarshal(b, &v)
+	return v, errors.WithStack(err)
+}
+
+// Set stores a value that never expires.
+func (kv *KV[K, V]) Set(ctx context.Context, key K, value V) error {
+	return kv.set(ctx, key, value, nil)
+}
+
+// SetWithTTL stores a value that expires after the ttl.
+func (kv *KV[K, V]) SetWithTTL(ctx context.Context, key K, value V, ttl time.Duration) error {
+	expires := kv.now() + ttl.Milliseconds()
+	return kv.set(ctx, key, value, &expires)
+}
+
+func (kv *KV[K, V]) set(ctx context.Context, key K, value V, expires *int64) error {
+	b, err := kv.cfg.codec.Marshal(value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = kv.db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			value = excluded.value,
+			expires_at = excluded.expires_at`,
+		kv.table), string(key), b, expires)
+	return errors.WithStack(err)
+}
+
+// Delete removes a key. Deleting a key that does not exist is not an error.
+func (kv *KV[K, V]) Delete(ctx context.Context, key K) error {
+	_, err := kv.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, kv.table), string(key))
+	return errors.WithStack(err)
+}
+
+// CompareAndSwap stores new at key only if the current value at key is old.
+// Values are compared using their encoded form. It reports whether the value
+// was swapped. The key's expiration is not changed.
+func (kv *KV[K, V]) CompareAndSwap(ctx context.Context, key K, old, new V) (bool, error) {
+	oldb, err := kv.cfg.codec.Marshal(old)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	newb, err := kv.cfg.codec.Marshal(new)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	res, err := kv.db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s SET value = ?
+		WHERE key = ? AND value = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		kv.table), newb, string(key), oldb, kv.now())
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, errors.WithStack(err)
+}
+
+// Scan returns an iterator over every unexpired entry whose key starts with
+// prefix in key order. An empty prefix will scan all entries.
+func (kv *KV[K, V]) Scan(ctx context.Context, prefix K) iter.Seq2[Entry[K, V], error] {
+	type kvRow struct {
+		Key     string `db:"key"`
+		Value   []byte `db:"value"`
+		Expires *int64 `db:"expires_at"`
+	}
+	query := fmt.Sprintf(`SELECT key, value, expires_at FROM %s
+		WHERE key >= ?1 AND (?2 IS NULL OR key < ?2)
+		  AND (expires_at IS NULL OR expires_at > ?3)
+		ORDER BY key`, kv.table)
+	return func(yield func(Entry[K, V], error) bool) {
+		var upper *string
+		if end, ok := prefixEnd(string(prefix)); ok {
+			upper = &end
+		}
+		for r, err := range Query[kvRow](ctx, db.Simple(kv.db), query, string(prefix), upper, kv.now()) {
+			var e Entry[K, V]
+			if err != nil {
+				yield(e, err)
+				return
+			}
+			e.Key = K(r.Key)
+			if r.Expires != nil {
+				e.ExpiresAt = time.UnixMilli(*r.Expires)
+			}
+			if err = kv.cfg.codec.Unmarshal(r.Value, &e.Value); err != nil {
+				yield(e, errors.WithStack(err))
+				return
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Sweep deletes expired keys in batches and returns the number of keys
+// deleted.
+func (kv *KV[K, V]) Sweep(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE key IN (
+		SELECT key FROM %[1]s WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?
+	)`, kv.table)
+	var total int64
+	for {
+		res, err := kv.db.ExecContext(ctx, query, kv.now(), kv.cfg.batchSize)
+		if err != nil {
+			return total, errors.WithStack(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, errors.WithStack(err)
+		}
+		total += n
+		if n < int64(kv.cfg.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// SweepEvery runs [KV.Sweep] on an interval until the context is done.
+func (kv *KV[K, V]) SweepEvery(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := kv.Sweep(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+func (kv *KV[K, V]) now() int64 { return kv.cfg.now().UnixMilli() }
+
+// prefixEnd returns the smallest string that is greater than every string
+// starting with prefix.
+func prefixEnd(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestKV(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	is := is.New(t)
+	ctx := t.Context()
+	d, err := File(filepath.Join(t.TempDir(), "kv.db"))
+	is.NoErr(err)
+	defer d.Close()
+	kv, err := NewKV[string, user](ctx, d, "users", WithSweepBatchSize[user](2))
+	is.NoErr(err)
+	now := time.UnixMilli(1_000_000)
+	kv.cfg.now = func() time.Time { return now }
+
+	_, err = kv.Get(ctx, "user:1")
+	is.True(errors.Is(err, ErrKeyNotFound))
+	is.NoErr(kv.Set(ctx, "user:1", user{Name: "alice", Age: 30}))
+	is.NoErr(kv.Set(ctx, "user:2", user{Name: "bob", Age: 40}))
+	is.NoErr(kv.Set(ctx, "group:1", user{Name: "admins"}))
+	u, err := kv.Get(ctx, "user:1")
+	is.NoErr(err)
+	is.Equal(u, user{Name: "alice", Age: 30})
+
+	ok, err := kv.CompareAndSwap(ctx, "user:1", user{Name: "alice", Age: 99}, user{Name: "alice", Age: 31})
+	is.NoErr(err)
+	is.True(!ok)
+	ok, err = kv.CompareAndSwap(ctx, "user:1", user{Name: "alice", Age: 30}, user{Name: "alice", Age: 31})
+	is.NoErr(err)
+	is.True(ok)
+	ok, err = kv.CompareAndSwap(ctx, "user:3", user{}, user{Name: "carl"})
+	is.NoErr(err)
+	is.True(!ok)
+
+	var keys []string
+	for e, err := range kv.Scan(ctx, "user:") {
+		is.NoErr(err)
+		keys = append(keys, e.Key)
+	}
+	is.Equal(keys, []string{"user:1", "user:2"})
+
+	for i := range 5 {
+		is.NoErr(kv.SetWithTTL(ctx, "tmp:"+string(rune('a'+i)), user{}, time.Minute))
+	}
+	for e, err := range kv.Scan(ctx, "tmp:") {
+		is.NoErr(err)
+		is.Equal(e.ExpiresAt, now.Add(time.Minute))
+		break
+	}
+	now = now.Add(time.Minute)
+	_, err = kv.Get(ctx, "tmp:a")
+	is.True(errors.Is(err, ErrKeyNotFound))
+	n, err := kv.Sweep(ctx)
+	is.NoErr(err)
+	is.Equal(n, int64(5))
+
+	is.NoErr(kv.Delete(ctx, "user:2"))
+	keys = keys[:0]
+	for e, err := range kv.Scan(ctx, "") {
+		is.NoErr(err)
+		keys = append(keys, e.Key)
+	}
+	is.Equal(keys, []string{"group:1", "user:1"})
+}
+
+func TestKV_SweepBatchSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		is := is.New(t)
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		d, err := InMemory()
+		is.NoErr(err)
+		defer d.Close()
+		kv, err := NewKV[string, int](ctx, d, "kv", WithSweepBatchSize[int](size))
+		is.NoErr(err)
+		is.Equal(kv.cfg.batchSize, defaultSweepBatchSize)
+		now := time.UnixMilli(1_000_000)
+		kv.cfg.now = func() time.Time { return now }
+		for i := range 3 {
+			is.NoErr(kv.SetWithTTL(ctx, fmt.Sprint(i), i, time.Minute))
+		}
+		now = now.Add(time.Minute)
+		n, err := kv.Sweep(ctx)
+		is.NoErr(err)
+		is.Equal(n, int64(3))
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	is := is.New(t)
+	end, ok := prefixEnd("ab")
+	is.True(ok)
+	is.Equal(end, "ac")
+	end, ok = prefixEnd("a\xff")
+	is.True(ok)
+	is.Equal(end, "b")
+	_, ok = prefixEnd("\xff\xff")
+	is.True(!ok)
+}
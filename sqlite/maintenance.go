@@ -0,0 +1,210 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckpointMode is the mode used when running PRAGMA wal_checkpoint.
+//
+// See https://www.sqlite.org/pragma.html#pragma_wal_checkpoint
+type CheckpointMode uint8
+
+const (
+	CheckpointTruncate CheckpointMode = iota
+	CheckpointPassive
+	CheckpointFull
+	CheckpointRestart
+)
+
+func (m CheckpointMode) String() string {
+	switch m {
+	case CheckpointTruncate:
+		return "TRUNCATE"
+	case CheckpointPassive:
+		return "PASSIVE"
+	case CheckpointFull:
+		return "FULL"
+	case CheckpointRestart:
+		return "RESTART"
+	}
+	return ""
+}
+
+// MaintenanceSchedule configures how often each maintenance task is run. A
+// zero interval disables the task.
+type MaintenanceSchedule struct {
+	// WalCheckpoint is how often to run PRAGMA wal_checkpoint. Unlike the
+	// [WalCheckpoint] option this keeps the WAL file from growing for the
+	// lifetime of the database rather than only checkpointing at startup.
+	WalCheckpoint  time.Duration
+	CheckpointMode CheckpointMode
+	// Optimize is how often to run PRAGMA optimize.
+	Optimize time.Duration
+	// IncrementalVacuum is how often to run PRAGMA incremental_vacuum. It only
+	// has an effect when auto_vacuum is set to INCREMENTAL.
+	IncrementalVacuum time.Duration
+	// VacuumPages is the max number of free pages to remove with each
+	// incremental vacuum. Zero will remove all of them.
+	VacuumPages int
+	// QuickCheck is how often to run PRAGMA quick_check.
+	QuickCheck time.Duration
+}
+
+// Maintainer runs periodic upkeep tasks against a database.
+type Maintainer struct {
+	db       *sql.DB
+	schedule MaintenanceSchedule
+	config   Config
+}
+
+// NewMaintainer creates a Maintainer for a database. The options are used to
+// configure logging, all other options are ignored.
+func NewMaintainer(database *sql.DB, schedule MaintenanceSchedule, opts ...Option) *Maintainer {
+	m := Maintainer{db: database, schedule: schedule}
+	for _, o := range opts {
+		o(&m.config)
+	}
+	return &m
+}
+
+// Run will run every scheduled task until the context is done. It only
+// returns once all the running tasks have stopped.
+func (m *Maintainer) Run(ctx context.Context) {
+	tasks := []struct {
+		name     string
+		interval time.Duration
+		run      func(context.Context) error
+	}{
+		{PragmaWalCheckpoint, m.schedule.WalCheckpoint, m.Checkpoint},
+		{"optimize", m.schedule.Optimize, m.Optimize},
+		{"incremental_vacuum", m.schedule.IncrementalVacuum, m.IncrementalVacuum},
+		{"quick_check", m.schedule.QuickCheck, m.QuickCheck},
+	}
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		if task.interval <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(task.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := task.run(ctx); err != nil && ctx.Err() == nil {
+					m.logger().Error("sqlite: maintenance task failed",
+						"task", task.name, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Checkpoint runs PRAGMA wal_checkpoint once.
+func (m *Maintainer) Checkpoint(ctx context.Context) error {
+	start := time.Now()
+	var busy, log, checkpointed int
+	query := fmt.Sprintf("PRAGMA %s(%s)", PragmaWalCheckpoint, m.schedule.CheckpointMode)
+	err := m.db.QueryRowContext(ctx, query).Scan(&busy, &log, &checkpointed)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	m.logger().Info("sqlite: wal checkpoint",
+		"mode", m.schedule.CheckpointMode.String(),
+		"busy", busy == 1,
+		"log_pages", log,
+		"checkpointed_pages", checkpointed,
+		"duration", time.Since(start))
+	return nil
+}
+
+// Optimize runs PRAGMA optimize once.
+func (m *Maintainer) Optimize(ctx context.Context) error {
+	start := time.Now()
+	if _, err := m.db.ExecContext(ctx, "PRAGMA optimize"); err != nil {
+		return errors.WithStack(err)
+	}
+	m.logger().Info("sqlite: optimize", "duration", time.Since(start))
+	return nil
+}
+
+// IncrementalVacuum runs PRAGMA incremental_vacuum once.
+func (m *Maintainer) IncrementalVacuum(ctx context.Context) error {
+	start := time.Now()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+	var before, after int64
+	if err = conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before); err != nil {
+		return errors.WithStack(err)
+	}
+	// incremental_vacuum only removes pages as its results are stepped
+	// through so the rows need to be read.
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", m.schedule.VacuumPages))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for rows.Next() {
+	}
+	if err = rows.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&after); err != nil {
+		return errors.WithStack(err)
+	}
+	m.logger().Info("sqlite: incremental vacuum",
+		"freed_pages", before-after,
+		"free_pages", after,
+		"duration", time.Since(start))
+	return nil
+}
+
+// ErrIntegrity is returned when a database integrity check finds problems.
+var ErrIntegrity = errors.New("sqlite: database integrity check failed")
+
+// QuickCheck runs PRAGMA quick_check once. It returns [ErrIntegrity] if any
+// problems are found.
+func (m *Maintainer) QuickCheck(ctx context.Context) error {
+	start := time.Now()
+	rows, err := m.db.QueryContext(ctx, "PRAGMA quick_check")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	problems := make([]string, 0)
+	for rows.Next() {
+		var msg string
+		if err = rows.Scan(&msg); err != nil {
+			return errors.WithStack(err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if len(problems) > 0 {
+		return errors.Wrap(ErrIntegrity, strings.Join(problems, "; "))
+	}
+	m.logger().Info("sqlite: quick check", "ok", true, "duration", time.Since(start))
+	return nil
+}
+
+func (m *Maintainer) logger() *slog.Logger { return m.config.loggerOrDefault() }
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.b.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.b.String()
+}
+
+func TestMaintainer(t *testing.T) {
+	is := is.New(t)
+	d, err := File(
+		filepath.Join(t.TempDir(), "test.db"),
+		JournalMode("WAL"),
+	)
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`PRAGMA auto_vacuum = INCREMENTAL; VACUUM;
+		CREATE TABLE t (b BLOB);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 100)
+		INSERT INTO t SELECT randomblob(4096) FROM n;
+		DELETE FROM t;`)
+	is.NoErr(err)
+
+	var logs syncBuffer
+	m := NewMaintainer(d, MaintenanceSchedule{
+		WalCheckpoint:     time.Millisecond,
+		Optimize:          time.Millisecond,
+		IncrementalVacuum: time.Millisecond,
+		QuickCheck:        time.Millisecond,
+	}, Logger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	deadline := time.After(5 * time.Second)
+	for !strings.Contains(logs.String(), "sqlite: quick check") ||
+		!strings.Contains(logs.String(), "sqlite: incremental vacuum") ||
+		!strings.Contains(logs.String(), "sqlite: wal checkpoint") ||
+		!strings.Contains(logs.String(), "sqlite: optimize") {
+		select {
+		case <-deadline:
+			t.Fatalf("maintenance tasks did not run:\n%s", logs.String())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop after the context was canceled")
+	}
+	is.True(!strings.Contains(logs.String(), "level=ERROR"))
+
+	var free int
+	is.NoErr(d.QueryRow("PRAGMA freelist_count").Scan(&free))
+	is.Equal(free, 0)
+	is.True(strings.Contains(logs.String(), "mode=TRUNCATE"))
+}
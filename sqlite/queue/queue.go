@@ -0,0 +1,451 @@
+// Package queue is a durable work queue stored in a SQLite database.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"time"
+
+	"github.com/harrybrwn/db"
+	"github.com/harrybrwn/x/parallel"
+	"github.com/harrybrwn/x/sqlite"
+	"github.com/pkg/errors"
+)
+
+// ErrEmpty is returned by [Queue.Dequeue] when there are no jobs ready to run.
+var ErrEmpty = errors.New("queue: no jobs ready")
+
+// ErrLeaseLost is returned when acknowledging a job whose lease has expired
+// and has since been given to another worker.
+var ErrLeaseLost = errors.New("queue: job lease lost")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS queue_jobs (
+	-- AUTOINCREMENT keeps ids from being reused once the newest job is
+	-- deleted. Dead letters keep the id of their job.
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue        TEXT    NOT NULL,
+	payload      BLOB,
+	priority     INTEGER NOT NULL DEFAULT 0,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at       INTEGER NOT NULL,
+	leased_until INTEGER,
+	last_error   TEXT,
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS queue_jobs_ready
+	ON queue_jobs (queue, priority DESC, run_at, id);
+CREATE TABLE IF NOT EXISTS queue_dead_letters (
+	id           INTEGER PRIMARY KEY,
+	queue        TEXT    NOT NULL,
+	payload      BLOB,
+	priority     INTEGER NOT NULL,
+	attempts     INTEGER NOT NULL,
+	max_attempts INTEGER NOT NULL,
+	last_error   TEXT,
+	created_at   INTEGER NOT NULL,
+	failed_at    INTEGER NOT NULL
+);`
+
+// Job is a unit of work stored in the queue.
+type Job struct {
+	ID       int64
+	Queue    string
+	Payload  []byte
+	Priority int
+	// Attempts is the number of times the job has been dequeued, including
+	// the current attempt.
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	CreatedAt   time.Time
+	// LastError is the error from the previous failed attempt.
+	LastError string
+}
+
+// row is how a job is stored, times are unix milliseconds.
+type row struct {
+	ID          int64   `db:"id"`
+	Queue       string  `db:"queue"`
+	Payload     []byte  `db:"payload"`
+	Priority    int     `db:"priority"`
+	Attempts    int     `db:"attempts"`
+	MaxAttempts int     `db:"max_attempts"`
+	RunAt       int64   `db:"run_at"`
+	CreatedAt   int64   `db:"created_at"`
+	LastError   *string `db:"last_error"`
+}
+
+func (r *row) job() *Job {
+	j := Job{
+		ID:          r.ID,
+		Queue:       r.Queue,
+		Payload:     r.Payload,
+		Priority:    r.Priority,
+		Attempts:    r.Attempts,
+		MaxAttempts: r.MaxAttempts,
+		RunAt:       time.UnixMilli(r.RunAt),
+		CreatedAt:   time.UnixMilli(r.CreatedAt),
+	}
+	if r.LastError != nil {
+		j.LastError = *r.LastError
+	}
+	return &j
+}
+
+const columns = `id, queue, payload, priority, attempts, max_attempts, run_at, created_at, last_error`
+
+type config struct {
+	visibility  time.Duration
+	maxAttempts int
+	backoff     func(attempt int) time.Duration
+	poll        time.Duration
+	now         func() time.Time
+}
+
+type Option func(*config)
+
+// WithVisibilityTimeout sets how long a dequeued job is hidden from other
+// workers. If a job is not acknowledged before its lease runs out it will be
+// given to another worker.
+func WithVisibilityTimeout(d time.Duration) Option { return func(c *config) { c.visibility = d } }
+
+// WithMaxAttempts sets the default number of times a job is attempted before
+// it is moved to the dead letter table.
+func WithMaxAttempts(n int) Option { return func(c *config) { c.maxAttempts = n } }
+
+// WithBackoff sets the function used to decide how long to wait before
+// retrying a failed job. The attempt starts at 1.
+func WithBackoff(fn func(attempt int) time.Duration) Option {
+	return func(c *config) { c.backoff = fn }
+}
+
+// WithPollInterval sets how long idle workers wait before checking for new
+// jobs.
+func WithPollInterval(d time.Duration) Option { return func(c *config) { c.poll = d } }
+
+// Backoff returns an exponential backoff with full jitter starting at base
+// and capped at max.
+func Backoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base << (attempt - 1)
+		if d <= 0 || d > max {
+			d = max
+		}
+		return d/2 + rand.N(d/2+1)
+	}
+}
+
+// Queue is a named queue of jobs. Many queues can share one database.
+type Queue struct {
+	db   *sql.DB
+	name string
+	cfg  config
+}
+
+// New creates a queue and the tables used to store it if they don't exist.
+func New(ctx context.Context, database *sql.DB, name string, opts ...Option) (*Queue, error) {
+	q := Queue{
+		db:   database,
+		name: name,
+		cfg: config{
+			visibility:  time.Minute,
+			maxAttempts: 5,
+			backoff:     Backoff(time.Second, time.Hour),
+			poll:        time.Second,
+			now:         time.Now,
+		},
+	}
+	for _, o := range opts {
+		o(&q.cfg)
+	}
+	if _, err := database.ExecContext(ctx, schema); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &q, nil
+}
+
+type enqueueOptions struct {
+	delay       time.Duration
+	priority    int
+	maxAttempts int
+}
+
+type EnqueueOption func(*enqueueOptions)
+
+// Delay will hide the job from workers until the delay has passed.
+func Delay(d time.Duration) EnqueueOption { return func(o *enqueueOptions) { o.delay = d } }
+
+// Priority sets the job's priority. Jobs with higher priorities are dequeued
+// first.
+func Priority(p int) EnqueueOption { return func(o *enqueueOptions) { o.priority = p } }
+
+// MaxAttempts overrides the queue's max attempts for a single job.
+func MaxAttempts(n int) EnqueueOption { return func(o *enqueueOptions) { o.maxAttempts = n } }
+
+// Enqueue adds a job to the queue and returns its ID.
+func (q *Queue) Enqueue(ctx context.Context, payload []byte, opts ...EnqueueOption) (int64, error) {
+	o := enqueueOptions{maxAttempts: q.cfg.maxAttempts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	now := q.cfg.now()
+	res, err := q.db.ExecContext(ctx, `
+		INSERT INTO queue_jobs (queue, payload, priority, max_attempts, run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		q.name, payload, o.priority, o.maxAttempts,
+		now.Add(o.delay).UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	id, err := res.LastInsertId()
+	return id, errors.WithStack(err)
+}
+
+// Dequeue leases the next job that is ready to run. The job must be passed to
+// [Queue.Ack] or [Queue.Nack] before the visibility timeout expires. It
+// returns [ErrEmpty] if no jobs are ready.
+func (q *Queue) Dequeue(ctx context.Context) (*Job, error) {
+	now := q.cfg.now().UnixMilli()
+	// Jobs that keep losing their lease, probably because the worker
+	// crashed, are moved to the dead letter table once they run out of
+	// attempts.
+	if err := q.deadLetterExpired(ctx, now); err != nil {
+		return nil, err
+	}
+	r, err := sqlite.QueryOne[row](ctx, db.Simple(q.db), `
+		UPDATE queue_jobs
+		SET leased_until = ?1, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM queue_jobs
+			WHERE queue = ?2
+			  AND run_at <= ?3
+			  AND (leased_until IS NULL OR leased_until <= ?3)
+			ORDER BY priority DESC, run_at, id
+			LIMIT 1
+		)
+		RETURNING `+columns,
+		now+q.cfg.visibility.Milliseconds(), q.name, now,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.job(), nil
+}
+
+// Ack marks a job as done and removes it from the queue.
+func (q *Queue) Ack(ctx context.Context, job *Job) error {
+	res, err := q.db.ExecContext(ctx,
+		`DELETE FROM queue_jobs WHERE id = ? AND attempts = ?`,
+		job.ID, job.Attempts,
+	)
+	return leaseResult(res, err)
+}
+
+// Nack marks an attempt of a job as failed. The job is retried after a backoff
+// or moved to the dead letter table if it has run out of attempts.
+func (q *Queue) Nack(ctx context.Context, job *Job, cause error) error {
+	msg := ""
+	if cause != nil {
+		msg = cause.Error()
+	}
+	now := q.cfg.now()
+	if job.Attempts >= job.MaxAttempts {
+		return q.deadLetter(ctx, job, msg, now)
+	}
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE queue_jobs
+		SET leased_until = NULL, run_at = ?, last_error = ?
+		WHERE id = ? AND attempts = ?`,
+		now.Add(q.cfg.backoff(job.Attempts)).UnixMilli(), msg, job.ID, job.Attempts,
+	)
+	return leaseResult(res, err)
+}
+
+// release gives up the lease on a job without counting the attempt.
+func (q *Queue) release(ctx context.Context, job *Job) error {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE queue_jobs
+		SET leased_until = NULL, attempts = attempts - 1
+		WHERE id = ? AND attempts = ?`,
+		job.ID, job.Attempts,
+	)
+	return leaseResult(res, err)
+}
+
+func (q *Queue) deadLetter(ctx context.Context, job *Job, msg string, now time.Time) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO queue_dead_letters
+			(id, queue, payload, priority, attempts, max_attempts, last_error, created_at, failed_at)
+		SELECT id, queue, payload, priority, attempts, max_attempts, ?, created_at, ?
+		FROM queue_jobs WHERE id = ? AND attempts = ?`,
+		msg, now.UnixMilli(), job.ID, job.Attempts,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM queue_jobs WHERE id = ? AND attempts = ?`,
+		job.ID, job.Attempts,
+	)
+	if err = leaseResult(res, err); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (q *Queue) deadLetterExpired(ctx context.Context, now int64) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	const expired = `queue = ? AND leased_until <= ? AND attempts >= max_attempts`
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO queue_dead_letters
+			(id, queue, payload, priority, attempts, max_attempts, last_error, created_at, failed_at)
+		SELECT id, queue, payload, priority, attempts, max_attempts,
+			'lease expired', created_at, ?
+		FROM queue_jobs WHERE `+expired,
+		now, q.name, now,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM queue_jobs WHERE `+expired, q.name, now); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// DeadLetters returns the jobs in this queue that ran out of attempts.
+func (q *Queue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	jobs := make([]*Job, 0)
+	for r, err := range sqlite.Query[row](ctx, db.Simple(q.db), `
+		SELECT id, queue, payload, priority, attempts, max_attempts,
+			failed_at AS run_at, created_at, last_error
+		FROM queue_dead_letters
+		WHERE queue = ?
+		ORDER BY failed_at, id`,
+		q.name,
+	) {
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, r.job())
+	}
+	return jobs, nil
+}
+
+// Retry moves a job from the dead letter table back into the queue with its
+// attempts reset.
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO queue_jobs
+			(id, queue, payload, priority, max_attempts, run_at, last_error, created_at)
+		SELECT id, queue, payload, priority, max_attempts, ?, last_error, created_at
+		FROM queue_dead_letters WHERE id = ? AND queue = ?`,
+		q.cfg.now().UnixMilli(), id, q.name,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM queue_dead_letters WHERE id = ?`, id); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// Len returns the number of jobs in the queue including jobs that are leased
+// or delayed.
+func (q *Queue) Len(ctx context.Context) (int, error) {
+	return sqlite.QueryOne[int](ctx, db.Simple(q.db),
+		`SELECT count(*) FROM queue_jobs WHERE queue = ?`, q.name)
+}
+
+// Work runs a number of workers that dequeue jobs and pass them to the
+// handler until the context is canceled. Jobs are acknowledged when the
+// handler returns nil and retried when it returns an error. Work only returns
+// early if the database returns an error.
+func (q *Queue) Work(ctx context.Context, workers int, handler parallel.Job[*Job, struct{}]) error {
+	var jobs parallel.BasicJobs
+	for range workers {
+		jobs.Add(func(ctx context.Context) error {
+			return q.work(ctx, handler)
+		})
+	}
+	// Do waits for every worker to finish the job it is holding.
+	err := parallel.Do(ctx, jobs...)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
+
+func (q *Queue) work(ctx context.Context, handler parallel.Job[*Job, struct{}]) error {
+	for {
+		job, err := q.Dequeue(ctx)
+		if errors.Is(err, ErrEmpty) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(q.cfg.poll):
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		_, err = handler(ctx, job)
+		// Finish the job even if the context was canceled while the handler
+		// was running so that it does not wait for its lease to expire.
+		fctx := context.WithoutCancel(ctx)
+		switch {
+		case err == nil:
+			err = q.Ack(fctx, job)
+		case ctx.Err() != nil:
+			err = q.release(fctx, job)
+		default:
+			err = q.Nack(fctx, job, err)
+		}
+		if err != nil && !errors.Is(err, ErrLeaseLost) {
+			return err
+		}
+	}
+}
+
+func leaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harrybrwn/x/sqlite"
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func newQueue(t *testing.T, opts ...Option) *Queue {
+	t.Helper()
+	d, err := sqlite.File(filepath.Join(t.TempDir(), "queue.db"), sqlite.JournalMode("WAL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	q, err := New(t.Context(), d, "test", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQueue(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	now := time.UnixMilli(1_000_000)
+	q := newQueue(t, WithBackoff(func(int) time.Duration { return time.Second }))
+	q.cfg.now = func() time.Time { return now }
+
+	_, err := q.Dequeue(ctx)
+	is.True(errors.Is(err, ErrEmpty))
+
+	_, err = q.Enqueue(ctx, []byte("low"))
+	is.NoErr(err)
+	_, err = q.Enqueue(ctx, []byte("delayed"), Delay(time.Minute), Priority(100))
+	is.NoErr(err)
+	_, err = q.Enqueue(ctx, []byte("high"), Priority(10), MaxAttempts(2))
+	is.NoErr(err)
+	n, err := q.Len(ctx)
+	is.NoErr(err)
+	is.Equal(n, 3)
+
+	job, err := q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(job.Payload), "high")
+	is.Equal(job.Attempts, 1)
+	is.NoErr(q.Nack(ctx, job, errors.New("first failure")))
+
+	// The failed job is waiting for its backoff.
+	low, err := q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(low.Payload), "low")
+	_, err = q.Dequeue(ctx)
+	is.True(errors.Is(err, ErrEmpty))
+
+	now = now.Add(time.Second)
+	job, err = q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(job.Payload), "high")
+	is.Equal(job.Attempts, 2)
+	is.Equal(job.LastError, "first failure")
+	is.NoErr(q.Nack(ctx, job, errors.New("second failure")))
+	dead, err := q.DeadLetters(ctx)
+	is.NoErr(err)
+	is.Equal(len(dead), 1)
+	is.Equal(string(dead[0].Payload), "high")
+	is.Equal(dead[0].LastError, "second failure")
+
+	// The low priority job's lease expires and it is given out again.
+	now = now.Add(time.Minute)
+	job, err = q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(job.Payload), "delayed")
+	is.NoErr(q.Ack(ctx, job))
+	job, err = q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(job.Payload), "low")
+	is.Equal(job.Attempts, 2)
+	is.True(errors.Is(q.Ack(ctx, low), ErrLeaseLost))
+	is.NoErr(q.Ack(ctx, job))
+
+	is.NoErr(q.Retry(ctx, dead[0].ID))
+	job, err = q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(string(job.Payload), "high")
+	is.Equal(job.Attempts, 1)
+	is.NoErr(q.Ack(ctx, job))
+	n, err = q.Len(ctx)
+	is.NoErr(err)
+	is.Equal(n, 0)
+}
+
+func TestQueue_DeadLetterIDs(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	q := newQueue(t, WithMaxAttempts(1))
+	fail := func(payload string) int64 {
+		id, err := q.Enqueue(ctx, []byte(payload))
+		is.NoErr(err)
+		job, err := q.Dequeue(ctx)
+		is.NoErr(err)
+		is.Equal(job.ID, id)
+		is.NoErr(q.Nack(ctx, job, errors.New("failed")))
+		return id
+	}
+	// Both jobs are the newest in the queue when they are dead lettered so
+	// their ids must not be handed out again.
+	a := fail("a")
+	b := fail("b")
+	is.True(a != b)
+	dead, err := q.DeadLetters(ctx)
+	is.NoErr(err)
+	is.Equal(len(dead), 2)
+
+	is.NoErr(q.Retry(ctx, a))
+	c, err := q.Enqueue(ctx, []byte("c"))
+	is.NoErr(err)
+	is.True(c != a && c != b)
+	job, err := q.Dequeue(ctx)
+	is.NoErr(err)
+	is.Equal(job.ID, a)
+	is.Equal(string(job.Payload), "a")
+	is.NoErr(q.Nack(ctx, job, errors.New("failed again")))
+	dead, err = q.DeadLetters(ctx)
+	is.NoErr(err)
+	is.Equal(len(dead), 2)
+	n, err := q.Len(ctx)
+	is.NoErr(err)
+	is.Equal(n, 1)
+}
+
+func TestQueue_Work(t *testing.T) {
+	is := is.New(t)
+	q := newQueue(t,
+		WithPollInterval(time.Millisecond),
+		WithBackoff(func(int) time.Duration { return 0 }),
+	)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	const jobs = 50
+	for i := range jobs {
+		_, err := q.Enqueue(ctx, fmt.Appendf(nil, "%d", i))
+		is.NoErr(err)
+	}
+	var (
+		mu     sync.Mutex
+		seen   = make(map[string]int)
+		failed = make(map[string]bool)
+	)
+	err := q.Work(ctx, 4, func(ctx context.Context, job *Job) (struct{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		p := string(job.Payload)
+		// Fail every job once to make sure they are retried.
+		if !failed[p] {
+			failed[p] = true
+			return struct{}{}, errors.New("try again")
+		}
+		seen[p]++
+		if len(seen) == jobs {
+			cancel()
+		}
+		return struct{}{}, nil
+	})
+	is.NoErr(err)
+	is.Equal(len(seen), jobs)
+	for _, n := range seen {
+		is.Equal(n, 1)
+	}
+	n, err := q.Len(context.Background())
+	is.NoErr(err)
+	is.Equal(n, 0)
+}
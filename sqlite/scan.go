@@ -0,0 +1,300 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/harrybrwn/db"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Query runs a query and returns an iterator over each row scanned into a T.
+//
+// If T is a struct then columns are matched to fields using the "db" struct
+// tag, the field's name, or the field's name in snake case, in that order.
+// Fields tagged with `db:"-"` are ignored and the fields of embedded structs
+// are matched as if they were fields of the outer struct. Columns without a
+// matching field result in an [*UnmappedColumnError]. Any other type is scanned
+// from a single column.
+//
+// NULL values can be scanned into pointer fields and [time.Time] fields may be
+// stored as TEXT in any of the [sqlite3.SQLiteTimestampFormats] or as INTEGER
+// unix timestamps.
+//
+// The query is not run until the iterator is used and iteration stops after
+// the first error.
+func Query[T any](ctx context.Context, database db.DB, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := database.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, errors.WithStack(err))
+			return
+		}
+		defer rows.Close()
+		scan, err := newRowScanner[T](rows)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for rows.Next() {
+			v, err := scan()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(zero, errors.WithStack(err))
+		}
+	}
+}
+
+// QueryOne runs a query and scans the first row into a T. It returns
+// [sql.ErrNoRows] if the query has no results. See [Query] for how rows are
+// scanned.
+func QueryOne[T any](ctx context.Context, database db.DB, query string, args ...any) (T, error) {
+	for v, err := range Query[T](ctx, database, query, args...) {
+		return v, err
+	}
+	var zero T
+	return zero, sql.ErrNoRows
+}
+
+// UnmappedColumnError is returned when a query result has a column that
+// cannot be matched to any field of the struct being scanned.
+type UnmappedColumnError struct {
+	Column string
+	Type   reflect.Type
+}
+
+func (e *UnmappedColumnError) Error() string {
+	return fmt.Sprintf("sqlite: column %q has no matching field in %s", e.Column, e.Type)
+}
+
+type columnLister interface {
+	Columns() ([]string, error)
+}
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	scannerType = reflect.TypeFor[sql.Scanner]()
+)
+
+func newRowScanner[T any](rows db.Rows) (func() (T, error), error) {
+	typ := reflect.TypeFor[T]()
+	if !isStruct(typ) {
+		return func() (T, error) {
+			var v T
+			err := rows.Scan(scanDest(reflect.ValueOf(&v).Elem()))
+			return v, errors.WithStack(err)
+		}, nil
+	}
+	cl, ok := rows.(columnLister)
+	if !ok {
+		return nil, errors.Errorf("sqlite: %T does not report its columns", rows)
+	}
+	columns, err := cl.Columns()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fields := structFields(typ)
+	paths := make([][]int, len(columns))
+	for i, col := range columns {
+		path, ok := fields[strings.ToLower(col)]
+		if !ok {
+			return nil, &UnmappedColumnError{Column: col, Type: typ}
+		}
+		paths[i] = path
+	}
+	dst := make([]any, len(columns))
+	return func() (T, error) {
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		for i, path := range paths {
+			dst[i] = scanDest(fieldByIndex(rv, path))
+		}
+		err := rows.Scan(dst...)
+		return v, errors.WithStack(err)
+	}, nil
+}
+
+func isStruct(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct &&
+		typ != timeType &&
+		!reflect.PointerTo(typ).Implements(scannerType)
+}
+
+// scanDest returns a value that can be passed to Scan that will store a
+// column in v.
+func scanDest(v reflect.Value) any {
+	switch v.Type() {
+	case timeType:
+		return &timeScanner{v: v}
+	case reflect.PointerTo(timeType):
+		return &timeScanner{v: v, ptr: true}
+	}
+	return v.Addr().Interface()
+}
+
+// fieldByIndex is the same as [reflect.Value.FieldByIndex] except that it
+// allocates nil embedded struct pointers.
+func fieldByIndex(v reflect.Value, path []int) reflect.Value {
+	for i, x := range path {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var fieldCache sync.Map // map[reflect.Type]map[string][]int
+
+// structFields returns a map of lowercase column names to struct field index
+// paths.
+func structFields(typ reflect.Type) map[string][]int {
+	if fields, ok := fieldCache.Load(typ); ok {
+		return fields.(map[string][]int)
+	}
+	found := make(map[string]structField)
+	collectFields(typ, nil, found)
+	fields := make(map[string][]int, len(found))
+	for name, f := range found {
+		fields[name] = f.path
+	}
+	actual, _ := fieldCache.LoadOrStore(typ, fields)
+	return actual.(map[string][]int)
+}
+
+type structField struct {
+	path   []int
+	tagged bool
+}
+
+// better reports whether f should be used over other when they both match the
+// same column. Tagged fields win over untagged fields and shallower fields win
+// over fields from embedded structs.
+func (f structField) better(other structField) bool {
+	if f.tagged != other.tagged {
+		return f.tagged
+	}
+	return len(f.path) < len(other.path)
+}
+
+func collectFields(typ reflect.Type, parent []int, fields map[string]structField) {
+	add := func(name string, f structField) {
+		if existing, ok := fields[name]; !ok || f.better(existing) {
+			fields[name] = f
+		}
+	}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+		path := append(append([]int{}, parent...), i)
+		if f.Anonymous && !hasTag {
+			t := f.Type
+			if t.Kind() == reflect.Pointer {
+				// The struct cannot be allocated through an unexported
+				// field so its fields are skipped like in encoding/json.
+				if !f.IsExported() {
+					continue
+				}
+				t = t.Elem()
+			}
+			if isStruct(t) {
+				collectFields(t, path, fields)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name, _, _ := strings.Cut(tag, ","); len(name) > 0 {
+			add(strings.ToLower(name), structField{path: path, tagged: true})
+			continue
+		}
+		add(strings.ToLower(f.Name), structField{path: path})
+		add(snakeCase(f.Name), structField{path: path})
+	}
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// timeScanner scans TEXT, INTEGER, and DATETIME columns into a time.Time or
+// *time.Time.
+type timeScanner struct {
+	v   reflect.Value
+	ptr bool
+}
+
+func (ts *timeScanner) Scan(src any) error {
+	var t time.Time
+	switch v := src.(type) {
+	case nil:
+		ts.v.SetZero()
+		return nil
+	case time.Time:
+		t = v
+	case int64:
+		t = time.Unix(v, 0).UTC()
+	case float64:
+		t = time.UnixMicro(int64(v * 1e6)).UTC()
+	case []byte:
+		return ts.Scan(string(v))
+	case string:
+		var err error
+		if t, err = parseTime(v); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("sqlite: cannot scan %T into time.Time", src)
+	}
+	if ts.ptr {
+		ts.v.Set(reflect.ValueOf(&t))
+	} else {
+		ts.v.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("sqlite: cannot parse %q as a time", s)
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+type scanBase struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+type scanUser struct {
+	scanBase
+	Name     string  `db:"username"`
+	Email    *string // NULL-able
+	Birthday *time.Time
+	Ignored  string `db:"-"`
+}
+
+func TestQuery(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	d, err := InMemory()
+	is.NoErr(err)
+	defer d.Close()
+	_, err = d.Exec(`
+	CREATE TABLE users (
+		id INTEGER PRIMARY KEY,
+		username TEXT,
+		email TEXT,
+		created_at INTEGER,
+		birthday TEXT
+	);
+	INSERT INTO users VALUES
+		(1, 'jim', NULL, 1700000000, '1990-02-03 04:05:06'),
+		(2, 'pam', 'pam@example.com', 1700000001, NULL)`)
+	is.NoErr(err)
+
+	database := db.Simple(d)
+	users := make([]scanUser, 0)
+	for u, err := range Query[scanUser](ctx, database, `SELECT * FROM users ORDER BY id`) {
+		is.NoErr(err)
+		users = append(users, u)
+	}
+	is.Equal(len(users), 2)
+	is.Equal(users[0].ID, int64(1))
+	is.Equal(users[0].Name, "jim")
+	is.Equal(users[0].Email, nil)
+	is.True(users[0].CreatedAt.Equal(time.Unix(1700000000, 0)))
+	is.True(users[0].Birthday.Equal(time.Date(1990, 2, 3, 4, 5, 6, 0, time.UTC)))
+	is.Equal(*users[1].Email, "pam@example.com")
+	is.Equal(users[1].Birthday, nil)
+
+	name, err := QueryOne[string](ctx, database, `SELECT username FROM users WHERE id = ?`, 2)
+	is.NoErr(err)
+	is.Equal(name, "pam")
+	_, err = QueryOne[scanUser](ctx, database, `SELECT * FROM users WHERE id = 99`)
+	is.True(errors.Is(err, sql.ErrNoRows))
+
+	_, err = QueryOne[scanUser](ctx, database, `SELECT id, 1 AS other FROM users`)
+	var unmapped *UnmappedColumnError
+	is.True(errors.As(err, &unmapped))
+	is.Equal(unmapped.Column, "other")
+	is.Equal(err.Error(), `sqlite: column "other" has no matching field in sqlite.scanUser`)
+
+	// Embedded pointers are allocated when they can be set.
+	type Base struct{ ID int64 }
+	type exported struct {
+		*Base
+		Name string
+	}
+	e, err := QueryOne[exported](ctx, database, `SELECT 1 AS id, 'a' AS name`)
+	is.NoErr(err)
+	is.Equal(e.ID, int64(1))
+	is.Equal(e.Name, "a")
+	type unexported struct {
+		*scanBase
+		Name string
+	}
+	_, err = QueryOne[unexported](ctx, database, `SELECT 1 AS id, 'a' AS name`)
+	is.True(errors.As(err, &unmapped))
+	is.Equal(unmapped.Column, "id")
+}
+
+func TestSnakeCase(t *testing.T) {
+	is := is.New(t)
+	for in, want := range map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"CreatedAt": "created_at",
+		"HTTPCode":  "http_code",
+		"name":      "name",
+	} {
+		is.Equal(snakeCase(in), want)
+	}
+}
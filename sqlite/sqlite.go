@@ -16,7 +16,9 @@ func Open(location string, config *Config) (*sql.DB, error) {
 	if config == nil {
 		panic("sqlite: *Config is required to open a database")
 	}
-	config.logger = slog.New(slog.DiscardHandler)
+	if config.logger == nil {
+		config.logger = slog.New(slog.DiscardHandler)
+	}
 	query, err := config.query()
 	if err != nil {
 		return nil, err
@@ -29,6 +31,8 @@ func Open(location string, config *Config) (*sql.DB, error) {
 	return open(&uri, config)
 }
 
+// OpenURI opens a database from a URI. Query parameters already in the URI,
+// like "mode=memory", are kept unless they are set by the options.
 func OpenURI(uri *url.URL, opts ...Option) (*sql.DB, error) {
 	var config Config
 	config.logger = slog.New(slog.DiscardHandler)
@@ -39,7 +43,11 @@ func OpenURI(uri *url.URL, opts ...Option) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	uri.RawQuery = query.Encode()
+	params := uri.Query()
+	for key, values := range query {
+		params[key] = values
+	}
+	uri.RawQuery = params.Encode()
 	return open(uri, &config)
 }
 
@@ -81,13 +89,10 @@ func InMemory(opts ...Option) (*sql.DB, error) {
 func open(uri *url.URL, config *Config) (*sql.DB, error) {
 	source := uri.String()
 	if config != nil && config.Debug {
-		config.logger.Debug("sql.Open", "driver", "sqlite3", "source", source)
+		config.logger.Debug("sql.Open", "source", source)
 	}
-	db, err := sql.Open("sqlite3", source)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	if err = config.pragmas(db); err != nil {
+	db := sql.OpenDB(config.newConnector(source))
+	if err := config.pragmas(db); err != nil {
 		return nil, err
 	}
 	return db, nil
@@ -128,26 +133,20 @@ func GetWalCheckpoint(database db.DB) (int, int, int, error) {
 }
 
 type DatabaseList struct {
-	Index    int
-	Name     string
-	Location string
+	Index    int    `db:"seq"`
+	Name     string `db:"name"`
+	Location string `db:"file"`
 }
 
 func GetPragmaDatabaseList(database db.DB) ([]DatabaseList, error) {
-	rows, err := database.QueryContext(
+	res := make([]DatabaseList, 0)
+	for dl, err := range Query[DatabaseList](
 		context.Background(),
+		database,
 		`PRAGMA `+PragmaDatabaseList,
-	)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer rows.Close()
-	res := make([]DatabaseList, 0)
-	for rows.Next() {
-		var dl DatabaseList
-		err = rows.Scan(&dl.Index, &dl.Name, &dl.Location)
+	) {
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
 		}
 		res = append(res, dl)
 	}
@@ -0,0 +1,360 @@
+// Package sqlitetest provides helpers for tests that use sqlite databases.
+package sqlitetest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/harrybrwn/x/sqlite"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateEnv is the environment variable that, when set to a true value, will
+// make golden file assertions write the golden file instead of comparing.
+//
+//	SQLITETEST_UPDATE=1 go test ./...
+const UpdateEnv = "SQLITETEST_UPDATE"
+
+// File opens a database in a temporary file that is removed after the test.
+func File(t testing.TB, opts ...sqlite.Option) *sql.DB {
+	t.Helper()
+	d, err := sqlite.File(filepath.Join(t.TempDir(), "test.db"), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+var memoryDBs atomic.Uint64
+
+// InMemory opens a shared-cache in-memory database that is only visible to
+// the test. Every connection in the pool sees the same database which lives
+// until the end of the test.
+func InMemory(t testing.TB, opts ...sqlite.Option) *sql.DB {
+	t.Helper()
+	name := fmt.Sprintf("%s-%d", strings.ReplaceAll(t.Name(), "/", "_"), memoryDBs.Add(1))
+	uri := url.URL{
+		Scheme:   "file",
+		Opaque:   url.PathEscape(name),
+		RawQuery: "mode=memory",
+	}
+	d, err := sqlite.OpenURI(&uri, append(opts, sqlite.Cache(sqlite.CacheModeShared))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A shared-cache in-memory database is deleted when its last connection
+	// is closed so hold a connection open for the length of the test.
+	conn, err := d.Conn(t.Context())
+	if err != nil {
+		d.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		d.Close()
+	})
+	return d
+}
+
+// Exec runs one or more statements and fails the test on error.
+func Exec(t testing.TB, d *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := d.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Load loads fixture files into the database. The format of each file is
+// chosen by its extension.
+//
+// ".sql" files are run as a script. ".yaml", ".yml", and ".json" files map
+// table names to a list of rows where each row maps column names to values:
+//
+//	users:
+//	  - id: 1
+//	    name: alice
+//	posts:
+//	  - user_id: 1
+//	    title: hello
+//
+// All files are loaded in one transaction with foreign key checks deferred
+// until it commits so tables may be listed in any order.
+func Load(t testing.TB, d *sql.DB, paths ...string) {
+	t.Helper()
+	if err := load(t.Context(), d, paths); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func load(ctx context.Context, d *sql.DB, paths []string) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var tables map[string][]map[string]any
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".sql":
+			if _, err = tx.ExecContext(ctx, string(raw)); err != nil {
+				return errors.Wrapf(err, "failed to run %s", path)
+			}
+			continue
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(raw, &tables)
+		case ".json":
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			err = dec.Decode(&tables)
+		default:
+			return errors.Errorf("unknown fixture format %q", path)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", path)
+		}
+		for _, table := range slices.Sorted(maps.Keys(tables)) {
+			for _, row := range tables[table] {
+				if err = insert(ctx, tx, table, row); err != nil {
+					return errors.Wrapf(err, "failed to load %s", path)
+				}
+			}
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func insert(ctx context.Context, tx *sql.Tx, table string, row map[string]any) error {
+	columns := slices.Sorted(maps.Keys(row))
+	names := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, c := range columns {
+		names[i] = sqlite.QuoteIdent(c)
+		args[i] = fixtureValue(row[c])
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		sqlite.QuoteIdent(table),
+		strings.Join(names, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+	)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return errors.WithStack(err)
+}
+
+// fixtureValue converts decoded fixture values into values supported by the
+// driver. Nested objects and lists are stored as json.
+func fixtureValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+	return v
+}
+
+// Snapshot is a copy of a database that it can be restored to.
+type Snapshot struct {
+	db   *sql.DB
+	path string
+}
+
+// TakeSnapshot copies the database so that it can be restored after a
+// subtest modifies it.
+//
+//	snap := sqlitetest.TakeSnapshot(t, db)
+//	t.Run("delete", func(t *testing.T) {
+//		t.Cleanup(func() { snap.Restore(t) })
+//		...
+//	})
+func TakeSnapshot(t testing.TB, d *sql.DB) *Snapshot {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	if _, err := d.ExecContext(t.Context(), `VACUUM INTO ?`, path); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to snapshot database"))
+	}
+	return &Snapshot{db: d, path: path}
+}
+
+// Restore replaces the contents of the database with the snapshot using the
+// backup API.
+func (s *Snapshot) Restore(t testing.TB) {
+	t.Helper()
+	if err := s.restore(context.Background()); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to restore snapshot"))
+	}
+}
+
+func (s *Snapshot) restore(ctx context.Context) error {
+	src, err := sql.Open("sqlite3", "file:"+s.path+"?mode=ro")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer src.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer srcConn.Close()
+	dstConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer dstConn.Close()
+	return dstConn.Raw(func(dst any) error {
+		dc, ok := sqlite.RawConn(dst)
+		if !ok {
+			return errors.Errorf("unsupported driver connection %T", dst)
+		}
+		return srcConn.Raw(func(src any) error {
+			backup, err := dc.Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if _, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(backup.Finish())
+		})
+	})
+}
+
+// AssertTable compares the contents of a table to a golden file. Rows are
+// ordered by every column so the output does not depend on insert order.
+// Set [UpdateEnv] to write the golden file.
+func AssertTable(t testing.TB, d *sql.DB, table, golden string) {
+	t.Helper()
+	var n int
+	err := d.QueryRowContext(t.Context(), `SELECT count(*) FROM pragma_table_info(?)`, table).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatalf("table %q does not exist", table)
+	}
+	order := make([]string, n)
+	for i := range order {
+		order[i] = fmt.Sprint(i + 1)
+	}
+	AssertQuery(t, d, golden, fmt.Sprintf("SELECT * FROM %s ORDER BY %s",
+		sqlite.QuoteIdent(table), strings.Join(order, ", ")))
+}
+
+// AssertQuery compares the results of a query to a golden file. Each row is
+// written on its own line with values formatted as SQL literals, e.g.
+//
+//	id|name|email
+//	1|'alice'|NULL
+//
+// Set [UpdateEnv] to write the golden file.
+func AssertQuery(t testing.TB, d *sql.DB, golden, query string, args ...any) {
+	t.Helper()
+	got, err := formatQuery(t.Context(), d, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update() {
+		if err = os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with %s=1 to create it)", err, UpdateEnv)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("query results do not match %s:\n--- want\n%s--- got\n%s", golden, want, got)
+	}
+}
+
+func formatQuery(ctx context.Context, d *sql.DB, query string, args ...any) ([]byte, error) {
+	rows, err := d.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var b bytes.Buffer
+	b.WriteString(strings.Join(columns, "|"))
+	b.WriteByte('\n')
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte('|')
+			}
+			b.WriteString(literal(v))
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), errors.WithStack(rows.Err())
+}
+
+func literal(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func update() bool {
+	switch strings.ToLower(os.Getenv(UpdateEnv)) {
+	case "1", "t", "true", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package sqlitetest
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/harrybrwn/x/sqlite"
+	"github.com/matryer/is"
+)
+
+func TestInMemory(t *testing.T) {
+	is := is.New(t)
+	d := InMemory(t)
+	d.SetMaxOpenConns(4)
+	Exec(t, d, `CREATE TABLE t (x INTEGER)`)
+	// Every connection sees the same database.
+	conns := make([]interface{ Close() error }, 0, 3)
+	for range 3 {
+		c, err := d.Conn(t.Context())
+		is.NoErr(err)
+		_, err = c.ExecContext(t.Context(), `INSERT INTO t VALUES (1)`)
+		is.NoErr(err)
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		is.NoErr(c.Close())
+	}
+	var n int
+	is.NoErr(d.QueryRow(`SELECT count(*) FROM t`).Scan(&n))
+	is.Equal(n, 3)
+
+	// Other tests do not share the database.
+	other := InMemory(t)
+	is.NoErr(other.QueryRow(`SELECT count(*) FROM sqlite_schema`).Scan(&n))
+	is.Equal(n, 0)
+}
+
+func TestFixtures(t *testing.T) {
+	for name, open := range map[string]func(testing.TB, ...sqlite.Option) *sql.DB{
+		"file":   File,
+		"memory": InMemory,
+	} {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			d := open(t, sqlite.WithPragma("foreign_keys", "ON"))
+			Load(t, d, "testdata/schema.sql", "testdata/users.yaml", "testdata/posts.json")
+			AssertTable(t, d, "users", "testdata/users.golden")
+			AssertQuery(t, d, "testdata/posts.golden",
+				`SELECT p.title, u.name, p.meta FROM posts p JOIN users u ON u.id = p.user_id ORDER BY p.id`)
+
+			snap := TakeSnapshot(t, d)
+			t.Run("modify", func(t *testing.T) {
+				t.Cleanup(func() { snap.Restore(t) })
+				Exec(t, d, `DELETE FROM posts; DELETE FROM users`)
+				Exec(t, d, `CREATE TABLE extra (x)`)
+			})
+			AssertTable(t, d, "users", "testdata/users.golden")
+			var n int
+			is.NoErr(d.QueryRow(`SELECT count(*) FROM sqlite_schema WHERE name = 'extra'`).Scan(&n))
+			is.Equal(n, 0)
+		})
+	}
+}
+
+func TestSnapshot_WrappedConn(t *testing.T) {
+	// Tracing and change feeds wrap the driver's connections.
+	for name, opt := range map[string]sqlite.Option{
+		"trace":   sqlite.Trace(true),
+		"changes": sqlite.WithChangeFeed(sqlite.NewChangeFeed()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			d := InMemory(t, opt)
+			Exec(t, d, `CREATE TABLE t (x); INSERT INTO t VALUES (1), (2)`)
+			snap := TakeSnapshot(t, d)
+			Exec(t, d, `DELETE FROM t`)
+			snap.Restore(t)
+			var n int
+			is.NoErr(d.QueryRow(`SELECT count(*) FROM t`).Scan(&n))
+			is.Equal(n, 2)
+		})
+	}
+}
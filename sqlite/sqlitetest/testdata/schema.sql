@@ -0,0 +1,11 @@
+CREATE TABLE users (
+	id    INTEGER PRIMARY KEY,
+	name  TEXT NOT NULL,
+	email TEXT
+);
+CREATE TABLE posts (
+	id      INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	title   TEXT NOT NULL,
+	meta    TEXT
+);
@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	PragmaPageCount     = "page_count"
+	PragmaPageSize      = "page_size"
+	PragmaFreelistCount = "freelist_count"
+	PragmaSchemaVersion = "schema_version"
+)
+
+// Statistics is a snapshot of the health of a database.
+type Statistics struct {
+	PageCount     int64
+	PageSize      int64
+	FreelistCount int64
+	// Size is the size of the main database in bytes.
+	Size int64
+	// WALSize is the size of the write-ahead log in bytes. It is zero when
+	// the database is not in WAL mode or is in memory.
+	WALSize     int64
+	JournalMode string
+	// SchemaVersion is incremented every time the schema changes.
+	SchemaVersion int64
+	// DataVersion changes when another connection commits a change. It is
+	// only meaningful when compared to values read from the same connection.
+	DataVersion int64
+	// Cache holds the page cache counters of one connection in the pool.
+	// Each connection has its own page cache and counters. It is empty when
+	// built without cgo.
+	Cache CacheStats
+	// Tables holds per-table sizes. It is nil unless SQLite was compiled with
+	// the dbstat virtual table (SQLITE_ENABLE_DBSTAT_VTAB).
+	Tables []TableStats
+	// Pool holds the connection pool stats from [sql.DB.Stats].
+	Pool sql.DBStats
+}
+
+// CacheStats are the page cache counters from sqlite3_db_status.
+type CacheStats struct {
+	// Used is the memory used by the page cache in bytes.
+	Used   int64
+	Hits   int64
+	Misses int64
+	Writes int64
+	Spills int64
+}
+
+// TableStats are the storage stats of a table from the dbstat virtual table.
+type TableStats struct {
+	Name string `db:"name"`
+	// Rows is an estimate of the number of rows taken from the number of
+	// cells in the table's leaf pages.
+	Rows int64 `db:"rows"`
+	// Pages is the number of pages used by the table.
+	Pages int64 `db:"pages"`
+	// Size is the size of the table in bytes, not including its indexes.
+	Size int64 `db:"size"`
+	// IndexSize is the total size of the table's indexes in bytes.
+	IndexSize int64 `db:"index_size"`
+}
+
+// Stats collects statistics about a database.
+func Stats(database *sql.DB) (*Statistics, error) {
+	var (
+		err   error
+		ctx   = context.Background()
+		stats = Statistics{Pool: database.Stats()}
+		d     = db.Simple(database)
+	)
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{
+		{PragmaPageCount, &stats.PageCount},
+		{PragmaPageSize, &stats.PageSize},
+		{PragmaFreelistCount, &stats.FreelistCount},
+		{PragmaSchemaVersion, &stats.SchemaVersion},
+		{PragmaDataVersion, &stats.DataVersion},
+	} {
+		if *p.dst, err = GetPragma[int64](d, p.name); err != nil {
+			return nil, errors.Wrapf(err, "failed to get %s", p.name)
+		}
+	}
+	stats.Size = stats.PageCount * stats.PageSize
+	if stats.JournalMode, err = GetJournalMode(d); err != nil {
+		return nil, err
+	}
+	if stats.WALSize, err = walSize(d); err != nil {
+		return nil, err
+	}
+	if stats.Tables, err = tableStats(ctx, d); err != nil {
+		return nil, err
+	}
+
+	if stats.Cache, err = cacheStats(ctx, database); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// See https://www.sqlite.org/c3ref/c_dbstatus_options.html
+const (
+	dbStatusCacheUsed  = 1
+	dbStatusCacheHit   = 7
+	dbStatusCacheMiss  = 8
+	dbStatusCacheWrite = 9
+	dbStatusCacheSpill = 12
+)
+
+// cacheStats reads the page cache counters of one connection with the
+// db_status SQL function from dbstatus.go. The stats are left empty when the
+// function is not available.
+func cacheStats(ctx context.Context, database *sql.DB) (CacheStats, error) {
+	var stats CacheStats
+	err := database.QueryRowContext(ctx, `SELECT
+		db_status(?), db_status(?), db_status(?), db_status(?), db_status(?)`,
+		dbStatusCacheUsed, dbStatusCacheHit, dbStatusCacheMiss, dbStatusCacheWrite, dbStatusCacheSpill,
+	).Scan(&stats.Used, &stats.Hits, &stats.Misses, &stats.Writes, &stats.Spills)
+	if err != nil && strings.Contains(err.Error(), "no such function") {
+		return CacheStats{}, nil
+	}
+	return stats, errors.WithStack(err)
+}
+
+func walSize(database db.DB) (int64, error) {
+	list, err := GetPragmaDatabaseList(database)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range list {
+		if d.Name != "main" || len(d.Location) == 0 {
+			continue
+		}
+		info, err := os.Stat(d.Location + "-wal")
+		if os.IsNotExist(err) {
+			return 0, nil
+		} else if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return info.Size(), nil
+	}
+	return 0, nil
+}
+
+func tableStats(ctx context.Context, database db.DB) ([]TableStats, error) {
+	ok, err := QueryOne[bool](ctx, database,
+		`SELECT count(*) > 0 FROM pragma_module_list WHERE name = 'dbstat'`)
+	if err != nil || !ok {
+		return nil, err
+	}
+	tables := make([]TableStats, 0)
+	for t, err := range Query[TableStats](ctx, database, `
+		SELECT
+			s.tbl_name AS name,
+			sum(CASE WHEN s.type = 'table' AND d.pagetype = 'leaf' THEN d.ncell ELSE 0 END) AS rows,
+			sum(CASE WHEN s.type = 'table' THEN 1 ELSE 0 END) AS pages,
+			sum(CASE WHEN s.type = 'table' THEN d.pgsize ELSE 0 END) AS size,
+			sum(CASE WHEN s.type = 'index' THEN d.pgsize ELSE 0 END) AS index_size
+		FROM dbstat AS d
+		JOIN sqlite_schema AS s ON s.name = d.name
+		GROUP BY s.tbl_name
+		ORDER BY s.tbl_name`) {
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestStats(t *testing.T) {
+	is := is.New(t)
+	d, err := File(filepath.Join(t.TempDir(), "stats.db"), JournalMode("WAL"))
+	is.NoErr(err)
+	defer d.Close()
+	d.SetMaxOpenConns(1)
+	_, err = d.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT);
+		CREATE INDEX t_v ON t (v);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 500)
+		INSERT INTO t (v) SELECT hex(randomblob(32)) FROM n`)
+	is.NoErr(err)
+	var v string
+	is.NoErr(d.QueryRow(`SELECT v FROM t WHERE id = 1`).Scan(&v))
+
+	stats, err := Stats(d)
+	is.NoErr(err)
+	is.True(stats.PageCount > 1)
+	is.Equal(stats.PageSize, int64(4096))
+	is.Equal(stats.Size, stats.PageCount*stats.PageSize)
+	is.Equal(stats.JournalMode, "wal")
+	is.True(stats.WALSize > 0)
+	is.Equal(stats.SchemaVersion, int64(2))
+	// Cache stats come from a C function registered on the connections of
+	// this package so make sure it is there instead of silently reporting
+	// zeros.
+	var hits int64
+	is.NoErr(d.QueryRow(`SELECT db_status(?)`, dbStatusCacheHit).Scan(&hits))
+	is.True(hits > 0)
+	is.True(stats.Cache.Hits > 0)
+	is.True(stats.Cache.Used > 0)
+	is.Equal(stats.Pool.MaxOpenConnections, 1)
+	if stats.Tables != nil {
+		is.Equal(len(stats.Tables), 1)
+		is.Equal(stats.Tables[0].Name, "t")
+		is.Equal(stats.Tables[0].Rows, int64(500))
+		is.True(stats.Tables[0].IndexSize > 0)
+	}
+}
+
+func TestStats_OtherConnections(t *testing.T) {
+	is := is.New(t)
+	d, err := InMemory()
+	is.NoErr(err)
+	defer d.Close()
+	is.NoErr(d.QueryRow(`SELECT db_status(?)`, dbStatusCacheHit).Err())
+
+	// Databases opened without this package don't get db_status.
+	other, err := sql.Open("sqlite3", ":memory:")
+	is.NoErr(err)
+	defer other.Close()
+	err = other.QueryRow(`SELECT db_status(?)`, dbStatusCacheHit).Err()
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no such function"))
+}
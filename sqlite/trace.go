@@ -0,0 +1,313 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// QueryEvent describes a single statement run against the database.
+type QueryEvent struct {
+	// Op is one of "exec", "query", or "prepare".
+	Op   string
+	SQL  string
+	Args int
+	// Duration is how long the statement took. For queries this includes the
+	// time spent reading rows up until the rows were closed.
+	Duration time.Duration
+	// Rows is the number of rows affected by an exec or the number of rows
+	// read from a query. It is -1 when unknown.
+	Rows int64
+	Err  error
+}
+
+// QueryHook is used to collect metrics about statements run against a
+// database.
+type QueryHook interface {
+	OnQuery(ctx context.Context, event *QueryEvent)
+}
+
+// QueryHookFunc is a function that implements [QueryHook].
+type QueryHookFunc func(ctx context.Context, event *QueryEvent)
+
+func (fn QueryHookFunc) OnQuery(ctx context.Context, event *QueryEvent) { fn(ctx, event) }
+
+// Trace will log every statement run against the database at debug level.
+func Trace(v bool) Option { return func(c *Config) { c.Trace = v } }
+
+// SlowQueryThreshold will log every statement that takes longer than d at warn
+// level.
+func SlowQueryThreshold(d time.Duration) Option {
+	return func(c *Config) { c.SlowQueryThreshold = d }
+}
+
+// WithQueryHook will call the hook after every statement run against the
+// database.
+func WithQueryHook(h QueryHook) Option { return func(c *Config) { c.QueryHook = h } }
+
+func (c *Config) tracing() bool {
+	return c.Trace || c.SlowQueryThreshold > 0 || c.QueryHook != nil
+}
+
+type tracer struct {
+	logger *slog.Logger
+	all    bool
+	slow   time.Duration
+	hook   QueryHook
+}
+
+func (t *tracer) trace(ctx context.Context, ev *QueryEvent) {
+	if t == nil {
+		return
+	}
+	if t.hook != nil {
+		t.hook.OnQuery(ctx, ev)
+	}
+	level := slog.LevelDebug
+	if t.slow > 0 && ev.Duration >= t.slow {
+		level = slog.LevelWarn
+	} else if !t.all {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("op", ev.Op),
+		slog.String("query", ev.SQL),
+		slog.Int("args", ev.Args),
+		slog.Duration("duration", ev.Duration),
+		slog.Int64("rows", ev.Rows),
+	}
+	if ev.Err != nil {
+		attrs = append(attrs, slog.Any("error", ev.Err))
+	}
+	msg := "sqlite: query"
+	if level == slog.LevelWarn {
+		msg = "sqlite: slow query"
+	}
+	t.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// tracingDriver wraps the sqlite3 driver so that every statement run on its
+// connections is traced and committed changes are published to a
+// [ChangeFeed]. Either the tracer or the change feed may be nil.
+type tracingDriver struct {
+	*sqlite3.SQLiteDriver
+	tracer  *tracer
+	changes *ChangeFeed
+}
+
+func (d *tracingDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &tracedConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), tracer: d.tracer}
+	if d.changes != nil {
+		c.changes = d.changes.hook(c.SQLiteConn)
+	}
+	return c, nil
+}
+
+// RawConn returns the go-sqlite3 connection behind a driver connection
+// from [sql.Conn.Raw]. Databases opened with tracing or a [ChangeFeed] wrap
+// their connections so they are not a [*sqlite3.SQLiteConn] themselves.
+func RawConn(driverConn any) (*sqlite3.SQLiteConn, bool) {
+	switch c := driverConn.(type) {
+	case *sqlite3.SQLiteConn:
+		return c, true
+	case *tracedConn:
+		return c.SQLiteConn, true
+	}
+	return nil, false
+}
+
+type tracedConn struct {
+	*sqlite3.SQLiteConn
+	tracer  *tracer
+	changes *connChanges
+}
+
+// done is called after every call that may have committed a transaction.
+func (c *tracedConn) done() {
+	if c.changes != nil {
+		c.changes.flush()
+	}
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, conn: c}, nil
+}
+
+type tracedTx struct {
+	driver.Tx
+	conn *tracedConn
+}
+
+func (tx *tracedTx) Commit() error {
+	err := tx.Tx.Commit()
+	tx.conn.done()
+	return err
+}
+
+func (tx *tracedTx) Rollback() error {
+	err := tx.Tx.Rollback()
+	tx.conn.done()
+	return err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	c.done()
+	c.tracer.trace(ctx, &QueryEvent{
+		Op:       "exec",
+		SQL:      query,
+		Args:     len(args),
+		Duration: time.Since(start),
+		Rows:     rowsAffected(res),
+		Err:      err,
+	})
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		c.done()
+		c.tracer.trace(ctx, &QueryEvent{
+			Op:       "query",
+			SQL:      query,
+			Args:     len(args),
+			Duration: time.Since(start),
+			Rows:     -1,
+			Err:      err,
+		})
+		return nil, err
+	}
+	return newTracedRows(ctx, c, rows, query, len(args), start), nil
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	c.tracer.trace(ctx, &QueryEvent{
+		Op:       "prepare",
+		SQL:      query,
+		Duration: time.Since(start),
+		Rows:     -1,
+		Err:      err,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{SQLiteStmt: stmt.(*sqlite3.SQLiteStmt), query: query, conn: c}, nil
+}
+
+type tracedStmt struct {
+	*sqlite3.SQLiteStmt
+	query string
+	conn  *tracedConn
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.SQLiteStmt.ExecContext(ctx, args)
+	s.conn.done()
+	s.conn.tracer.trace(ctx, &QueryEvent{
+		Op:       "exec",
+		SQL:      s.query,
+		Args:     len(args),
+		Duration: time.Since(start),
+		Rows:     rowsAffected(res),
+		Err:      err,
+	})
+	return res, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.SQLiteStmt.QueryContext(ctx, args)
+	if err != nil {
+		s.conn.done()
+		s.conn.tracer.trace(ctx, &QueryEvent{
+			Op:       "query",
+			SQL:      s.query,
+			Args:     len(args),
+			Duration: time.Since(start),
+			Rows:     -1,
+			Err:      err,
+		})
+		return nil, err
+	}
+	return newTracedRows(ctx, s.conn, rows, s.query, len(args), start), nil
+}
+
+// tracedRows counts the rows read from a query and traces the query once the
+// rows are closed. A statement that writes, like an INSERT with a RETURNING
+// clause, is only committed when its rows are closed.
+type tracedRows struct {
+	*sqlite3.SQLiteRows
+	ctx   context.Context
+	event QueryEvent
+	start time.Time
+	err   error
+	conn  *tracedConn
+}
+
+func newTracedRows(ctx context.Context, conn *tracedConn, rows driver.Rows, query string, args int, start time.Time) driver.Rows {
+	r, ok := rows.(*sqlite3.SQLiteRows)
+	if !ok {
+		return rows
+	}
+	return &tracedRows{
+		SQLiteRows: r,
+		ctx:        ctx,
+		event:      QueryEvent{Op: "query", SQL: query, Args: args},
+		start:      start,
+		conn:       conn,
+	}
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.SQLiteRows.Next(dest)
+	switch err {
+	case nil:
+		r.event.Rows++
+	case io.EOF:
+	default:
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	r.conn.done()
+	r.event.Duration = time.Since(r.start)
+	r.event.Err = r.err
+	r.conn.tracer.trace(r.ctx, &r.event)
+	return err
+}
+
+func rowsAffected(res driver.Result) int64 {
+	if res == nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []QueryEvent
+}
+
+func (r *eventRecorder) OnQuery(_ context.Context, ev *QueryEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, *ev)
+	r.mu.Unlock()
+}
+
+func TestTrace(t *testing.T) {
+	is := is.New(t)
+	var (
+		logs bytes.Buffer
+		rec  eventRecorder
+	)
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	d, err := InMemory(
+		Logger(logger),
+		Trace(true),
+		WithQueryHook(&rec),
+		WithFunction("sleep", func(ms int) int {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return ms
+		}, false),
+		SlowQueryThreshold(20*time.Millisecond),
+	)
+	is.NoErr(err)
+	defer d.Close()
+	d.SetMaxOpenConns(1)
+
+	_, err = d.Exec(`CREATE TABLE t (n INT)`)
+	is.NoErr(err)
+	_, err = d.Exec(`INSERT INTO t VALUES (?), (?), (?)`, 1, 2, 3)
+	is.NoErr(err)
+	rows, err := d.Query(`SELECT n FROM t WHERE n > ?`, 1)
+	is.NoErr(err)
+	for rows.Next() {
+	}
+	is.NoErr(rows.Close())
+	stmt, err := d.Prepare(`SELECT sleep(?)`)
+	is.NoErr(err)
+	var n int
+	is.NoErr(stmt.QueryRow(25).Scan(&n))
+	is.NoErr(stmt.Close())
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var insert, query *QueryEvent
+	for i, ev := range rec.events {
+		switch {
+		case strings.HasPrefix(ev.SQL, "INSERT"):
+			insert = &rec.events[i]
+		case strings.HasPrefix(ev.SQL, "SELECT n"):
+			query = &rec.events[i]
+		}
+	}
+	is.True(insert != nil)
+	is.Equal(insert.Op, "exec")
+	is.Equal(insert.Args, 3)
+	is.Equal(insert.Rows, int64(3))
+	is.True(query != nil)
+	is.Equal(query.Op, "query")
+	is.Equal(query.Args, 1)
+	is.Equal(query.Rows, int64(2))
+
+	out := logs.String()
+	is.True(strings.Contains(out, `level=DEBUG msg="sqlite: query" op=exec query="INSERT INTO t VALUES (?), (?), (?)" args=3`))
+	is.True(strings.Contains(out, `level=WARN msg="sqlite: slow query" op=query query="SELECT sleep(?)" args=1`))
+}
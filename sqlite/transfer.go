@@ -0,0 +1,528 @@
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/harrybrwn/db"
+	"github.com/pkg/errors"
+)
+
+// Format is a file format used to import and export tables.
+type Format uint8
+
+const (
+	// FormatCSV is comma separated values with a header row.
+	FormatCSV Format = iota
+	// FormatNDJSON is newline delimited json with one object per row.
+	FormatNDJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatCSV:
+		return "csv"
+	case FormatNDJSON:
+		return "ndjson"
+	default:
+		return fmt.Sprintf("Format(%d)", f)
+	}
+}
+
+// ImportOptions configure [Import].
+type ImportOptions struct {
+	Format Format
+	// Create will create the table if it does not exist.
+	Create bool
+	// InferTypes will guess the type of each column from the first SampleRows
+	// rows. Inferred types are used for the columns of created tables and to
+	// convert CSV values, which are otherwise inserted as text. Empty CSV
+	// values are inserted as NULL when inferring types.
+	InferTypes bool
+	// SampleRows is the number of rows used to infer types. Defaults to 100.
+	SampleRows int
+	// BatchSize is the number of rows inserted in each transaction. Defaults
+	// to 1000.
+	BatchSize int
+	// Progress is called with the total number of rows imported after each
+	// batch is committed.
+	Progress func(rows int64)
+}
+
+// Import reads rows from r and inserts them into a table. CSV input must start
+// with a header row of column names. Each NDJSON object maps column names to
+// values and nested objects or arrays are stored as json text.
+//
+// Input is streamed and rows are committed in batches so a failed import may
+// leave earlier batches in the table. It returns the number of rows imported.
+func Import(ctx context.Context, database *sql.DB, table string, r io.Reader, opts *ImportOptions) (int64, error) {
+	var o ImportOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.SampleRows <= 0 {
+		o.SampleRows = 100
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	var src recordReader
+	switch o.Format {
+	case FormatCSV:
+		src = newCSVReader(r)
+	case FormatNDJSON:
+		src = newNDJSONReader(r)
+	default:
+		return 0, errors.Errorf("sqlite: unknown import format %v", o.Format)
+	}
+
+	// Buffer the sample so that columns and types are known before the
+	// table is created.
+	sample := make([]map[string]any, 0, o.SampleRows)
+	for len(sample) < o.SampleRows {
+		rec, err := src.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		sample = append(sample, rec)
+	}
+	columns := src.Columns()
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	// Types holds every column, with an empty type when not inferring.
+	types := make(map[string]string, len(columns))
+	for _, c := range columns {
+		var t string
+		for i, rec := range sample {
+			if !o.InferTypes {
+				break
+			}
+			t = mergeType(t, inferType(rec[c]), i == 0)
+		}
+		types[c] = t
+	}
+	if o.Create {
+		defs := make([]string, len(columns))
+		for i, c := range columns {
+			defs[i] = strings.TrimSpace(QuoteIdent(c) + " " + types[c])
+		}
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", QuoteIdent(table), strings.Join(defs, ", "))
+		if _, err := database.ExecContext(ctx, query); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	ins := importer{
+		db:       database,
+		columns:  columns,
+		types:    types,
+		convert:  o.InferTypes,
+		progress: o.Progress,
+		query: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			QuoteIdent(table),
+			strings.Join(mapSlice(columns, QuoteIdent), ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+		),
+	}
+	batch := sample
+	for {
+		if len(batch) > 0 {
+			if err := ins.insert(ctx, batch); err != nil {
+				return ins.total, err
+			}
+		}
+		batch = batch[:0]
+		for len(batch) < o.BatchSize {
+			rec, err := src.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return ins.total, err
+			}
+			batch = append(batch, rec)
+		}
+		if len(batch) == 0 {
+			return ins.total, nil
+		}
+	}
+}
+
+type importer struct {
+	db       *sql.DB
+	query    string
+	columns  []string
+	types    map[string]string
+	convert  bool
+	progress func(int64)
+	total    int64
+}
+
+func (im *importer) insert(ctx context.Context, batch []map[string]any) error {
+	tx, err := im.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, im.query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer stmt.Close()
+	args := make([]any, len(im.columns))
+	for _, rec := range batch {
+		for k := range rec {
+			if _, ok := im.types[k]; !ok {
+				return errors.Errorf("sqlite: import row %d has unknown column %q", im.total+1, k)
+			}
+		}
+		for i, c := range im.columns {
+			args[i] = rec[c]
+			if s, ok := args[i].(string); ok && im.convert {
+				args[i] = convertText(s, im.types[c])
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			return errors.Wrapf(err, "failed to import row %d", im.total+1)
+		}
+		im.total++
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.WithStack(err)
+	}
+	if im.progress != nil {
+		im.progress(im.total)
+	}
+	return nil
+}
+
+type recordReader interface {
+	Next() (map[string]any, error)
+	// Columns returns the columns seen so far in the order they were seen.
+	Columns() []string
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	return &csvReader{r: cr}
+}
+
+func (r *csvReader) Next() (map[string]any, error) {
+	if r.header == nil {
+		header, err := r.r.Read()
+		if err != nil {
+			if err != io.EOF {
+				err = errors.WithStack(err)
+			}
+			return nil, err
+		}
+		r.header = slices.Clone(header)
+		if len(r.header) > 0 {
+			r.header[0] = strings.TrimPrefix(r.header[0], "\ufeff")
+		}
+	}
+	record, err := r.r.Read()
+	if err != nil {
+		if err != io.EOF {
+			err = errors.WithStack(err)
+		}
+		return nil, err
+	}
+	rec := make(map[string]any, len(record))
+	for i, v := range record {
+		rec[r.header[i]] = v
+	}
+	return rec, nil
+}
+
+func (r *csvReader) Columns() []string { return r.header }
+
+type ndjsonReader struct {
+	r       *bufio.Reader
+	columns []string
+	seen    map[string]struct{}
+	line    int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{r: bufio.NewReader(r), seen: make(map[string]struct{})}
+}
+
+func (r *ndjsonReader) Next() (map[string]any, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err != io.EOF {
+				err = errors.WithStack(err)
+			}
+			return nil, err
+		}
+		r.line++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var obj map[string]any
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err = dec.Decode(&obj); err != nil {
+			return nil, errors.Wrapf(err, "invalid json on line %d", r.line)
+		}
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			if _, ok := r.seen[k]; !ok {
+				r.seen[k] = struct{}{}
+				r.columns = append(r.columns, k)
+			}
+			obj[k] = jsonValue(obj[k])
+		}
+		return obj, nil
+	}
+}
+
+func (r *ndjsonReader) Columns() []string { return r.columns }
+
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
+
+const (
+	typeInteger = "INTEGER"
+	typeReal    = "REAL"
+	typeText    = "TEXT"
+)
+
+// inferType returns the column type of a single value. An empty string means
+// the value says nothing about the type.
+func inferType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64, bool:
+		return typeInteger
+	case float64:
+		return typeReal
+	case string:
+		if len(v) == 0 {
+			return ""
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return typeInteger
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return typeReal
+		}
+		return typeText
+	}
+	return ""
+}
+
+func mergeType(a, b string, first bool) string {
+	switch {
+	case first || len(a) == 0:
+		return b
+	case len(b) == 0 || a == b:
+		return a
+	case a == typeInteger && b == typeReal, a == typeReal && b == typeInteger:
+		return typeReal
+	default:
+		return typeText
+	}
+}
+
+func convertText(s, typ string) any {
+	if len(s) == 0 {
+		return nil
+	}
+	switch typ {
+	case typeInteger:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case typeReal:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+func mapSlice[T, U any](s []T, fn func(T) U) []U {
+	res := make([]U, len(s))
+	for i, v := range s {
+		res[i] = fn(v)
+	}
+	return res
+}
+
+// ExportOptions configure [Export].
+type ExportOptions struct {
+	Format Format
+	// Progress is called with the total number of rows written every
+	// ProgressEvery rows and once more when the export is done.
+	Progress      func(rows int64)
+	ProgressEvery int
+}
+
+// Export runs a query and writes the results to w. CSV output starts with a
+// header row and NULL values are written as empty fields. NDJSON output writes
+// one object per row with keys in column order. It returns the number of rows
+// written.
+func Export(ctx context.Context, database db.DB, w io.Writer, opts *ExportOptions, query string, args ...any) (int64, error) {
+	var o ExportOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ProgressEvery <= 0 {
+		o.ProgressEvery = 1000
+	}
+	rows, err := database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer rows.Close()
+	cols, ok := rows.(interface{ Columns() ([]string, error) })
+	if !ok {
+		return 0, errors.Errorf("sqlite: rows of type %T do not have columns", rows)
+	}
+	columns, err := cols.Columns()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	var (
+		write func([]any) error
+		flush func() error
+		bw    = bufio.NewWriter(w)
+	)
+	switch o.Format {
+	case FormatCSV:
+		cw := csv.NewWriter(bw)
+		if err = cw.Write(columns); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		record := make([]string, len(columns))
+		write = func(values []any) error {
+			for i, v := range values {
+				record[i] = exportText(v)
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+	case FormatNDJSON:
+		keys := make([][]byte, len(columns))
+		for i, c := range columns {
+			if keys[i], err = json.Marshal(c); err != nil {
+				return 0, errors.WithStack(err)
+			}
+		}
+		write = func(values []any) error {
+			bw.WriteByte('{')
+			for i, v := range values {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				bw.Write(keys[i])
+				bw.WriteByte(':')
+				b, err := json.Marshal(exportJSON(v))
+				if err != nil {
+					return err
+				}
+				bw.Write(b)
+			}
+			_, err := bw.WriteString("}\n")
+			return err
+		}
+		flush = bw.Flush
+	default:
+		return 0, errors.Errorf("sqlite: unknown export format %v", o.Format)
+	}
+
+	var n int64
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return n, errors.WithStack(err)
+		}
+		if err = write(values); err != nil {
+			return n, errors.WithStack(err)
+		}
+		n++
+		if o.Progress != nil && n%int64(o.ProgressEvery) == 0 {
+			o.Progress(n)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return n, errors.WithStack(err)
+	}
+	if err = flush(); err != nil {
+		return n, errors.WithStack(err)
+	}
+	if o.Progress != nil && n%int64(o.ProgressEvery) != 0 {
+		o.Progress(n)
+	}
+	return n, nil
+}
+
+func exportText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func exportJSON(v any) any {
+	if b, ok := v.([]byte); ok && utf8.Valid(b) {
+		return string(b)
+	}
+	return v
+}
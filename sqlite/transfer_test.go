@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harrybrwn/db"
+	"github.com/matryer/is"
+)
+
+func TestImportExport(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+	d, err := File(filepath.Join(t.TempDir(), "transfer.db"))
+	is.NoErr(err)
+	defer d.Close()
+
+	const input = "\ufeffid,name,score,joined\n" +
+		"1,alice,9.5,2024-01-02\n" +
+		"2,\"bob, jr\",7,\n" +
+		"3,carol,,2024-03-04\n"
+	var progress []int64
+	n, err := Import(ctx, d, "people", strings.NewReader(input), &ImportOptions{
+		Format:     FormatCSV,
+		Create:     true,
+		InferTypes: true,
+		SampleRows: 2,
+		BatchSize:  2,
+		Progress:   func(n int64) { progress = append(progress, n) },
+	})
+	is.NoErr(err)
+	is.Equal(n, int64(3))
+	is.Equal(progress, []int64{2, 3})
+
+	cols, err := tableColumns(ctx, db.Simple(d), "people")
+	is.NoErr(err)
+	types := make([]string, len(cols))
+	for i, c := range cols {
+		types[i] = c.Name + " " + c.Type
+	}
+	is.Equal(types, []string{"id INTEGER", "name TEXT", "score REAL", "joined TEXT"})
+	var typeofs string
+	is.NoErr(d.QueryRow(`SELECT group_concat(typeof(score), ',') FROM people`).Scan(&typeofs))
+	is.Equal(typeofs, "real,real,null")
+
+	var out bytes.Buffer
+	n, err = Export(ctx, db.Simple(d), &out, nil, `SELECT * FROM people ORDER BY id`)
+	is.NoErr(err)
+	is.Equal(n, int64(3))
+	is.Equal(out.String(), "id,name,score,joined\n"+
+		"1,alice,9.5,2024-01-02\n"+
+		"2,\"bob, jr\",7,\n"+
+		"3,carol,,2024-03-04\n")
+
+	out.Reset()
+	progress = progress[:0]
+	n, err = Export(ctx, db.Simple(d), &out, &ExportOptions{
+		Format:        FormatNDJSON,
+		Progress:      func(n int64) { progress = append(progress, n) },
+		ProgressEvery: 2,
+	}, `SELECT id, name, score FROM people WHERE id < ? ORDER BY id`, 3)
+	is.NoErr(err)
+	is.Equal(n, int64(2))
+	is.Equal(progress, []int64{2})
+	ndjson := out.String()
+	is.Equal(ndjson, `{"id":1,"name":"alice","score":9.5}`+"\n"+
+		`{"id":2,"name":"bob, jr","score":7}`+"\n")
+
+	// Round trip the export into a new table.
+	n, err = Import(ctx, d, "copy", strings.NewReader(ndjson+"\n"+`{"id":3,"tags":["a"]}`),
+		&ImportOptions{Format: FormatNDJSON, Create: true, InferTypes: true, SampleRows: 5})
+	is.NoErr(err)
+	is.Equal(n, int64(3))
+	var tags string
+	is.NoErr(d.QueryRow(`SELECT tags FROM copy WHERE id = 3`).Scan(&tags))
+	is.Equal(tags, `["a"]`)
+
+	// Columns not seen in the sample are rejected.
+	_, err = Import(ctx, d, "copy", strings.NewReader(`{"id":4}`+"\n"+`{"id":5,"other":1}`),
+		&ImportOptions{Format: FormatNDJSON, SampleRows: 1})
+	is.True(err != nil)
+}
@@ -9,14 +9,19 @@ import (
 	"golang.org/x/text/unicode/norm"
 )
 
-var normalizer = transform.Chain(
-	norm.NFD,
-	runes.Remove(runes.In(unicode.Mn)),
-	norm.NFC,
-)
-
+// Clean removes accents and other combining marks from s. It is safe for
+// concurrent use.
 func Clean(s string) (string, error) {
-	res, _, err := transform.String(normalizer, s)
+	// Transformers keep state between calls so a new chain is needed for
+	// every call.
+	res, _, err := transform.String(
+		transform.Chain(
+			norm.NFD,
+			runes.Remove(runes.In(unicode.Mn)),
+			norm.NFC,
+		),
+		s,
+	)
 	return res, err
 }
 
@@ -1,6 +1,7 @@
 package text
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -135,4 +136,32 @@ func TestIsURLSimple(t *testing.T) {
 			t.Errorf("%q should not be marked as a url", s)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestClean(t *testing.T) {
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				for in, exp := range map[string]string{
+					"Café":     "Cafe",
+					"ÉCOLE":    "ECOLE",
+					"naïve":    "naive",
+					"no marks": "no marks",
+				} {
+					res, err := Clean(in)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if res != exp {
+						t.Errorf("Clean(%q) = %q, expected %q", in, res, exp)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}